@@ -20,12 +20,16 @@ func printHelp() {
 	help += fmt.Sprintf("   %-12s restarts trakx daemon\n", "restart")
 	help += fmt.Sprintf("   %-12s executes trakx, doesn't return\n", "execute")
 	help += fmt.Sprintf("   %-12s wipes trakx pid file, use if you encounter errors with start/stop/restart commands\n", "reset")
+	help += fmt.Sprintf("   %-12s manages trusted sources of the running trakx: list, add, remove, suspend or scope\n", "sources")
 
 	help += "Usage:\n"
 	help += fmt.Sprintf("   %s <command>\n", os.Args[0])
 
 	help += "Example:\n"
 	help += fmt.Sprintf("   %s status\n", os.Args[0])
+	help += fmt.Sprintf("   %s sources add name=origin ip=1.2.3.4 port=4000\n", os.Args[0])
+	help += fmt.Sprintf("   %s sources suspend name=origin duration=1h\n", os.Args[0])
+	help += fmt.Sprintf("   %s sources scope name=origin groups=releases\n", os.Args[0])
 
 	fmt.Print(help)
 }
@@ -87,6 +91,21 @@ func main() {
 			logFatal(err)
 		}
 		fmt.Println("wiped!")
+	case "sources":
+		action := "list"
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+		}
+		var args []string
+		if len(os.Args) > 3 {
+			args = os.Args[3:]
+		}
+
+		resp, err := controller.Sources(action, args)
+		if err != nil {
+			logFatal(err)
+		}
+		fmt.Println(string(resp))
 	default:
 		fmt.Fprintf(os.Stderr, "invalid command: '%s'\n\n", os.Args[1])
 		printHelp()
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+const adminTimeout = 5 * time.Second
+
+// Sources calls the trusted source admin api of the running tracker.
+// Action is one of "list", "add", "remove", "suspend" or "scope" and args are "key=value" parameters, ex: "name=origin".
+func (controller *Controller) Sources(action string, args []string) ([]byte, error) {
+	if config.Config.Admin.Token == "" || config.Config.Admin.Port == 0 {
+		return nil, errors.New("admin api disabled, set admin.token and admin.port in the config")
+	}
+	if config.Config.HTTP.Mode != config.TrackerModeEnabled {
+		return nil, errors.New("admin api requires the http tracker to be enabled")
+	}
+
+	path := "/admin/sources"
+	switch action {
+	case "list":
+	case "add", "remove", "suspend", "scope":
+		path += "/" + action
+	default:
+		return nil, errors.New("invalid sources action: '" + action + "'")
+	}
+
+	query := url.Values{}
+	var sourceKey string
+	for _, arg := range args {
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, errors.New("invalid argument '" + arg + "', expected key=value")
+		}
+		if key == "key" { // keys are secrets, the tracker only accepts them in a header
+			sourceKey = val
+			continue
+		}
+		query.Set(key, val)
+	}
+
+	// the admin listener may be bound to a single address, unspecified ones are reached over localhost
+	host := "localhost"
+	if ip, err := netip.ParseAddr(config.Config.Admin.IP); err == nil && !ip.IsUnspecified() {
+		host = ip.String()
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(config.Config.Admin.Port))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s?%s", addr, path, query.Encode()), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create admin request")
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Config.Admin.Token)
+	if sourceKey != "" {
+		req.Header.Set("X-Source-Key", sourceKey)
+	}
+
+	client := http.Client{Timeout: adminTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "admin request failed")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read admin response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return body, errors.Errorf("admin request returned status %d: %s", resp.StatusCode, body)
+	}
+
+	return body, nil
+}
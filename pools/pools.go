@@ -2,7 +2,6 @@ package pools
 
 import (
 	"github.com/crimist/trakx/bencoding"
-	"github.com/crimist/trakx/tracker/storage"
 )
 
 var (
@@ -10,7 +9,6 @@ var (
 	Peerlists6        *Pool[[]byte]
 	BaselineProviders *Pool[[]byte]
 	Dictionaries      *Pool[*bencoding.Dictionary]
-	Peers             *Pool[*storage.Peer]
 )
 
 func Initialize(numwantLimit int) {
@@ -47,8 +45,4 @@ func Initialize(numwantLimit int) {
 	}, func(dictionary *bencoding.Dictionary) {
 		dictionary.Reset()
 	})
-
-	Peers = NewPool[*storage.Peer](func() any {
-		return new(storage.Peer)
-	}, nil)
 }
@@ -10,6 +10,18 @@ const (
 	TrackerModeEnabled  = "enabled"  // http tracker enabled
 	TrackerModeInfo     = "info"     // http information server, no tracker
 	TrackerModeDisabled = "disabled" // http disabled
+
+	BaselineSelectionRandom      = "random"      // uniformly random baseline provider
+	BaselineSelectionLeastLoaded = "leastloaded" // baseline provider with the fewest recent referrals
+	BaselineSelectionWeighted    = "weighted"    // random baseline provider weighted by its capacity over its load
+
+	OffendersLast = "last" // peers with recent offences are placed last in good actors' peer lists
+	OffendersOmit = "omit" // peers with recent offences are left out of good actors' peer lists
+	OffendersAny  = "any"  // peers with recent offences are handed out like any other
+
+	BehaviorPolicyFreeRider  = "freerider"  // downloaded without uploading since the last announce
+	BehaviorPolicyRatio      = "ratio"      // share ratio below Behavior.Ratio.Min
+	BehaviorPolicyUploadRate = "uploadrate" // upload rate over Behavior.UploadRate.Window below Behavior.UploadRate.Min
 )
 
 var (
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -26,6 +27,10 @@ type Configuration struct {
 		Base time.Duration
 		Fuzz time.Duration
 	}
+	Scrape struct {
+		Interval time.Duration     // min_request_interval of scrape responses (BEP 48)
+		Names    map[string]string // hex infohash to the torrent name given in scrape responses
+	}
 	HTTP struct {
 		Mode    string
 		IP      string
@@ -51,30 +56,120 @@ type Configuration struct {
 	Numwant struct {
 		Default uint
 		Limit   uint
+		Seeds   float64 // share of a leecher's peer list given to seeds, see Unset
+		Local   float64 // share of the peer list ranked by closeness to the requester, the rest stays random
+
+		Offenders string  // how peers with recent offences are handed to good actors
+		Reputable float64 // seed share added for leechers in good standing, scaled by their reputation up to Reputation.Max
 	}
 	DB struct {
 		Type   string
+		Shards int // number of independently locked parts the swarms are split into
+		Limits struct {
+			Peers      uint // peers across all swarms
+			Swarms     uint
+			SwarmPeers uint // peers in a single swarm
+			IPSwarms   uint // swarms an address may be a peer in
+		}
 		Backup struct {
 			Frequency time.Duration
 			Type      string
 			Path      string
 		}
-		TrustedSources []RawSocketAddress
-		Trim           time.Duration
-		Expiry         time.Duration
+		TrustedSources  []TrustedSource
+		HashGroups      map[string][]string // group name to hex infohashes
+		Resolve         time.Duration       // interval trusted source hostnames are resolved on
+		SignatureWindow time.Duration
+		Trim            time.Duration
+		Expiry          time.Duration
 	}
 	Behavior struct {
+		Policy      string
+		Shadow      []string // policies judged next to the active one but never enforced
 		MinLeechers uint16
+		Ratio       struct {
+			Min           float64
+			MinDownloaded int64
+		}
+		UploadRate struct {
+			Window time.Duration
+			Min    int64
+		}
+		Penalty struct {
+			Numwant          uint
+			Interval         time.Duration
+			WithholdBaseline bool
+			BanOffences      uint
+			BanDuration      time.Duration
+			Forget           time.Duration
+		}
+	}
+	Report struct {
+		Peers      bool // accept reports from peers, trusted sources may always report
+		PeerLimit  uint // reports accepted per address within PeerWindow
+		PeerWindow time.Duration
+		PeerWeight float64 // reputation removed from the reported address by a peer report
+	}
+	Reputation struct {
+		HalfLife    time.Duration
+		Seeding     float64
+		Detection   float64
+		Max         float64
+		BaselineMin float64 // see Unset
+	}
+	Baseline struct {
+		Selection       string
+		ReferralWindow  time.Duration
+		DefaultCapacity uint16
+		Numwant         struct {
+			Default uint
+			Limit   uint
+		}
+		Authorized time.Duration // how long a peer referred to a baseline provider stays in its authorised leechers
+		Handout    HandoutRule
+		Torrents   map[string]HandoutRule // hex infohash or name of DB.HashGroups to the rule used instead of Handout
+	}
+	Admin struct {
+		IP    string // served apart from the tracker, on localhost by default
+		Port  int
+		Token string
 	}
 	Path struct {
-		Log string
-		Pid string
+		Log       string
+		Pid       string
+		Sources   string
+		Decisions string
+		Locality  string
 	}
 }
 
+// RawSocketAddress holds where a trusted source announces from.
+// IP may be a CIDR prefix and Host a hostname resolved every DB.Resolve, only one of them may be set.
+// Ports is a port range "low-high" or "*" for any port, it overrides Port.
 type RawSocketAddress struct {
-	IP   string
-	Port uint16
+	IP    string
+	Host  string `json:",omitempty"`
+	Port  uint16
+	Ports string `json:",omitempty"`
+}
+
+// TrustedSource holds the configuration of a reliable source that may register as a baseline provider.
+// If Key is set the source authenticates by signing its announces and the address is ignored.
+// If Hashes or Groups are set the source may only register for those infohashes.
+type TrustedSource struct {
+	RawSocketAddress `fig:",squash"`
+	Name             string
+	Key              string   // "hmac:<hex secret>" or "ed25519:<hex public key>"
+	Hashes           []string `json:",omitempty"` // hex infohashes
+	Groups           []string `json:",omitempty"` // names of DB.HashGroups
+}
+
+// HandoutRule decides when a peer is handed baseline providers, zero values disable a condition.
+type HandoutRule struct {
+	MaxSeeders  uint16        // only while the swarm has fewer seeders
+	Stalled     uint16        // only to leechers whose left hasn't decreased for this many announces
+	Bootstrap   time.Duration // always while the swarm is younger, overrides MaxSeeders and Stalled
+	NoBadActors bool          // never to addresses with unforgiven bad actor offences
 }
 
 // Loaded returns true if the config was successfully parsed and loaded.
@@ -105,6 +200,13 @@ func (conf *Configuration) SetLogLevel(level LogLevel) {
 var oneTimeSetup sync.Once
 
 // Parse updates logger and limits based on the configuration settings.
+// Unset marks the options for which zero is a valid setting so Parse can tell them apart from options left out of the config.
+// Load calls it before loading, options still marked by Parse are given their default.
+func (config *Configuration) Unset() {
+	config.Numwant.Seeds = math.NaN()
+	config.Reputation.BaselineMin = math.NaN()
+}
+
 func (config *Configuration) Parse() error {
 	// one time logger atom setup
 	oneTimeSetup.Do(func() {
@@ -116,6 +218,12 @@ func (config *Configuration) Parse() error {
 	// set strings to lowercase
 	config.LogLevel = LogLevel(strings.ToLower(string(config.LogLevel)))
 	config.HTTP.Mode = strings.ToLower(config.HTTP.Mode)
+	config.Baseline.Selection = strings.ToLower(config.Baseline.Selection)
+	config.Numwant.Offenders = strings.ToLower(config.Numwant.Offenders)
+	config.Behavior.Policy = strings.ToLower(config.Behavior.Policy)
+	for i := range config.Behavior.Shadow {
+		config.Behavior.Shadow[i] = strings.ToLower(config.Behavior.Shadow[i])
+	}
 
 	// dev env check
 	if config.LogLevel.Debug() {
@@ -157,10 +265,101 @@ func (config *Configuration) Parse() error {
 		config.DB.Backup.Path = os.Getenv(strings.TrimPrefix(config.DB.Backup.Path, "ENV:"))
 	}
 
+	// resolve env vars for admin token
+	if strings.HasPrefix(config.Admin.Token, "ENV:") {
+		config.Admin.Token = os.Getenv(strings.TrimPrefix(config.Admin.Token, "ENV:"))
+	}
+
+	// scrapes are wanted no more often than announces by default
+	if config.Scrape.Interval <= 0 {
+		config.Scrape.Interval = config.Announce.Base
+	}
+
+	// peer list mix
+	if math.IsNaN(config.Numwant.Seeds) {
+		config.Numwant.Seeds = 0.5
+	} else if config.Numwant.Seeds < 0 || config.Numwant.Seeds > 1 {
+		return errors.Errorf("numwant.seeds %v must be within [0, 1]", config.Numwant.Seeds)
+	}
+	if config.Numwant.Offenders == "" {
+		config.Numwant.Offenders = OffendersLast
+	}
+	if config.Numwant.Reputable < 0 {
+		config.Numwant.Reputable = 0
+	}
+	if config.Numwant.Local < 0 {
+		config.Numwant.Local = 0 // locality ranking disabled
+	} else if config.Numwant.Local > 1 {
+		config.Numwant.Local = 1
+	}
+
+	// database shards
+	if config.DB.Shards <= 0 {
+		config.DB.Shards = 64
+	}
+
+	// trusted source hostnames are resolved this often
+	if config.DB.Resolve <= 0 {
+		config.DB.Resolve = 5 * time.Minute
+	}
+
+	// baseline provider signatures older or newer than this are rejected
+	if config.DB.SignatureWindow <= 0 {
+		config.DB.SignatureWindow = 30 * time.Second
+	}
+
 	// behavior
+	if config.Behavior.Policy == "" {
+		config.Behavior.Policy = BehaviorPolicyFreeRider
+	}
+	if config.Behavior.UploadRate.Window <= 0 {
+		config.Behavior.UploadRate.Window = 30 * time.Minute
+	}
 	if config.Behavior.MinLeechers < 2 {
 		config.Behavior.MinLeechers = 2 // should have another leecher other than self to upload at minimum
 	}
+	if config.Behavior.Penalty.BanOffences > 0 && config.Behavior.Penalty.BanDuration <= 0 {
+		config.Behavior.Penalty.BanDuration = 10 * time.Minute
+	}
+	if config.Behavior.Penalty.Forget <= 0 {
+		config.Behavior.Penalty.Forget = time.Hour
+	}
+
+	// reputation
+	if config.Reputation.HalfLife <= 0 {
+		config.Reputation.HalfLife = 24 * time.Hour
+	}
+	if config.Reputation.Max <= 0 {
+		config.Reputation.Max = 100
+	}
+	if math.IsNaN(config.Reputation.BaselineMin) {
+		config.Reputation.BaselineMin = -config.Reputation.Max
+	}
+
+	// reports
+	if config.Report.PeerWindow <= 0 {
+		config.Report.PeerWindow = time.Hour
+	}
+
+	// baseline provider selection
+	if config.Baseline.Selection == "" {
+		config.Baseline.Selection = BaselineSelectionRandom
+	}
+	if config.Baseline.ReferralWindow <= 0 {
+		config.Baseline.ReferralWindow = 10 * time.Minute
+	}
+	if config.Baseline.Authorized <= 0 {
+		config.Baseline.Authorized = time.Hour
+	}
+	if config.Baseline.DefaultCapacity == 0 {
+		config.Baseline.DefaultCapacity = 1
+	}
+	if config.Baseline.Numwant.Limit == 0 {
+		config.Baseline.Numwant.Limit = 1
+	}
+	if config.Baseline.Numwant.Default == 0 || config.Baseline.Numwant.Default > config.Baseline.Numwant.Limit {
+		config.Baseline.Numwant.Default = config.Baseline.Numwant.Limit
+	}
 
 	// resolve paths
 	home, err := os.UserHomeDir()
@@ -169,6 +368,9 @@ func (config *Configuration) Parse() error {
 	}
 	config.Path.Pid = strings.ReplaceAll(config.Path.Pid, "~", home)
 	config.Path.Log = strings.ReplaceAll(config.Path.Log, "~", home)
+	config.Path.Sources = strings.ReplaceAll(config.Path.Sources, "~", home)
+	config.Path.Decisions = strings.ReplaceAll(config.Path.Decisions, "~", home)
+	config.Path.Locality = strings.ReplaceAll(config.Path.Locality, "~", home)
 
 	// If $PORT var set override port for appengines (like heroku)
 	if appenginePort := os.Getenv("PORT"); appenginePort != "" {
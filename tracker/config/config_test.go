@@ -0,0 +1,60 @@
+package config
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestParseUnset(t *testing.T) {
+	unset := math.NaN()
+	cases := []struct {
+		name        string
+		seeds       float64
+		baselineMin float64
+		wantSeeds   float64
+		wantMin     float64
+		ok          bool
+	}{
+		{"unset", unset, unset, 0.5, -100, true},
+		{"zero", 0, 0, 0, 0, true},
+		{"negativeSeeds", -0.1, unset, 0, 0, false},
+		{"seedsAboveOne", 1.1, unset, 0, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := Configuration{}
+			config.Reputation.Max = 100
+			config.Numwant.Seeds = c.seeds
+			config.Reputation.BaselineMin = c.baselineMin
+
+			err := config.Parse()
+			if (err == nil) != c.ok {
+				t.Fatalf("Parse() error = %v, want ok %v", err, c.ok)
+			}
+			if !c.ok {
+				return
+			}
+			if config.Numwant.Seeds != c.wantSeeds {
+				t.Errorf("Numwant.Seeds = %v, want %v", config.Numwant.Seeds, c.wantSeeds)
+			}
+			if config.Reputation.BaselineMin != c.wantMin {
+				t.Errorf("Reputation.BaselineMin = %v, want %v", config.Reputation.BaselineMin, c.wantMin)
+			}
+		})
+	}
+}
+
+func TestLoadZeroSeeds(t *testing.T) {
+	os.Setenv("TRAKX_NUMWANT_SEEDS", "0")
+	defer os.Unsetenv("TRAKX_NUMWANT_SEEDS")
+
+	config, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Numwant.Seeds != 0 {
+		t.Errorf("Numwant.Seeds = %v, want 0", config.Numwant.Seeds)
+	}
+}
@@ -15,6 +15,7 @@ import (
 // This function is automatically called when the config package is imported.
 func Load() (*Configuration, error) {
 	conf := new(Configuration)
+	conf.Unset()
 
 	home, err := os.UserHomeDir()
 	if err != nil {
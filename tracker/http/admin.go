@@ -0,0 +1,295 @@
+package http
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+var (
+	adminHeader        = []byte("HTTP/1.1 200\r\nContent-Type: application/json; charset=utf-8\r\n\r\n")
+	adminBadRequest    = []byte("HTTP/1.1 400\r\nContent-Type: application/json; charset=utf-8\r\n\r\n")
+	bearerScheme       = []byte("Bearer ")
+	sourceKeyHeader    = "X-Source-Key" // keys of added trusted sources, kept out of the query string and access logs
+	adminSourcesPrefix = "/admin/sources"
+	adminRatesPath     = "/admin/rates"
+)
+
+// adminSource is the admin api representation of a trusted source, keys are never returned
+type adminSource struct {
+	Name           string   `json:"name"`
+	IP             string   `json:"ip,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	Port           uint16   `json:"port,omitempty"`
+	Ports          string   `json:"ports,omitempty"`
+	KeyType        string   `json:"keyType,omitempty"`
+	SuspendedUntil int64    `json:"suspendedUntil,omitempty"`
+	Hashes         []string `json:"hashes,omitempty"`
+	Groups         []string `json:"groups,omitempty"`
+}
+
+// adminRates is the admin api representation of the transfer rates of a swarm in bytes per second
+type adminRates struct {
+	Upload   int64           `json:"upload"`
+	Download int64           `json:"download"`
+	Peers    []adminPeerRate `json:"peers"`
+}
+
+type adminPeerRate struct {
+	ID       string `json:"id"`
+	IP       string `json:"ip"`
+	Port     uint16 `json:"port"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+}
+
+// header returns the value of the request header, header names are case insensitive
+func header(data []byte, name string) ([]byte, bool) {
+	// skip the request line
+	end := bytes.Index(data, []byte("\r\n"))
+	if end == -1 {
+		return nil, false
+	}
+	data = data[end+2:]
+
+	// headers end at the first empty line
+	for {
+		end = bytes.Index(data, []byte("\r\n"))
+		if end <= 0 {
+			return nil, false
+		}
+		field := data[:end]
+		data = data[end+2:]
+
+		colon := bytes.IndexByte(field, ':')
+		if colon != -1 && bytes.EqualFold(field[:colon], []byte(name)) {
+			return bytes.TrimSpace(field[colon+1:]), true
+		}
+	}
+}
+
+// authorized returns true if the request carries the configured admin bearer token
+func authorized(data []byte) bool {
+	if config.Config.Admin.Token == "" {
+		return false
+	}
+
+	value, ok := header(data, "Authorization")
+	// the scheme is case insensitive too
+	if !ok || len(value) < len(bearerScheme) || !bytes.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+		return false
+	}
+	token := bytes.TrimSpace(value[len(bearerScheme):])
+
+	return subtle.ConstantTimeCompare(token, []byte(config.Config.Admin.Token)) == 1
+}
+
+// queryParams maps the parsed request parameters by key
+func queryParams(p params) map[string]string {
+	vals := make(map[string]string)
+	for _, param := range p {
+		if param == nil {
+			continue
+		}
+		if equal := bytes.IndexByte(param, '='); equal == -1 {
+			vals[string(param)] = ""
+		} else {
+			vals[string(param[:equal])] = string(param[equal+1:])
+		}
+	}
+	return vals
+}
+
+// listParam splits a comma separated parameter, an empty parameter is an empty list
+func listParam(val string) []string {
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
+func adminError(conn net.Conn, msg string) {
+	data, _ := json.Marshal(map[string]string{"error": msg})
+	conn.Write(append(adminBadRequest, data...))
+}
+
+func adminWrite(conn net.Conn, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		adminError(conn, err.Error())
+		return
+	}
+	conn.Write(append(adminHeader, data...))
+}
+
+// serveAdmin routes a request to the admin listener
+func (t *HTTPTracker) serveAdmin(conn net.Conn, data []byte, p *parsed) {
+	switch {
+	case strings.HasPrefix(p.Path, adminSourcesPrefix):
+		t.adminSources(conn, data, p)
+	case p.Path == adminRatesPath:
+		t.adminRates(conn, data, p)
+	default:
+		writeStatus(conn, "404")
+	}
+}
+
+// adminSources serves the trusted source management api:
+//
+//	/admin/sources                                                        lists the trusted sources
+//	/admin/sources/add?name=&ip=&host=&port=&ports=&hashes=&groups=       adds a trusted source, its key is sent in the X-Source-Key header
+//	/admin/sources/remove?name=                                           removes a trusted source and evicts its baseline providers
+//	/admin/sources/suspend?name=&duration=                                suspends a trusted source for the duration, 0 lifts the suspension
+//	/admin/sources/scope?name=&hashes=&groups=                            limits a trusted source to the infohashes and hash groups, none lifts the limit
+//
+// ip may be a CIDR prefix and ports a range "low-high" or "*".
+// hashes are comma separated hex infohashes and groups are comma separated hash group names.
+func (t *HTTPTracker) adminSources(conn net.Conn, data []byte, p *parsed) {
+	if !authorized(data) {
+		writeStatus(conn, "401")
+		return
+	}
+
+	vals := queryParams(p.Params)
+
+	switch p.Path[len(adminSourcesPrefix):] {
+	case "", "/":
+		sources := t.peerdb.TrustedSources()
+		resp := make([]adminSource, len(sources))
+		for i, source := range sources {
+			resp[i] = adminSource{
+				Name:           source.Name,
+				SuspendedUntil: source.SuspendedUntil,
+			}
+			if source.Addr.IsValid() {
+				addr := source.Addr.Raw()
+				resp[i].IP, resp[i].Host, resp[i].Port, resp[i].Ports = addr.IP, addr.Host, addr.Port, addr.Ports
+			}
+			if source.Key != nil {
+				resp[i].KeyType = source.Key.Type
+			}
+			for _, hash := range source.Hashes {
+				resp[i].Hashes = append(resp[i].Hashes, hex.EncodeToString(hash[:]))
+			}
+			resp[i].Groups = source.Groups
+		}
+		adminWrite(conn, resp)
+	case "/add":
+		// query strings end up in access logs
+		if _, ok := vals["key"]; ok {
+			adminError(conn, "key must be sent in the "+sourceKeyHeader+" header")
+			return
+		}
+		key, _ := header(data, sourceKeyHeader)
+		raw := config.TrustedSource{
+			Name:   vals["name"],
+			Key:    string(key),
+			Hashes: listParam(vals["hashes"]),
+			Groups: listParam(vals["groups"]),
+		}
+		raw.IP = vals["ip"]
+		raw.Host = vals["host"]
+		raw.Ports = vals["ports"]
+		if vals["port"] != "" {
+			port, err := strconv.ParseUint(vals["port"], 10, 16)
+			if err != nil {
+				adminError(conn, "invalid port")
+				return
+			}
+			raw.Port = uint16(port)
+		}
+
+		source, err := storage.ParseTrustedSource(raw)
+		if err != nil {
+			adminError(conn, err.Error())
+			return
+		}
+		if err := t.peerdb.AddTrustedSource(source); err != nil {
+			adminError(conn, err.Error())
+			return
+		}
+		adminWrite(conn, map[string]string{"added": source.Name})
+	case "/remove":
+		if err := t.peerdb.RemoveTrustedSource(vals["name"]); err != nil {
+			adminError(conn, err.Error())
+			return
+		}
+		adminWrite(conn, map[string]string{"removed": vals["name"]})
+	case "/suspend":
+		duration, err := time.ParseDuration(vals["duration"])
+		if err != nil || duration < 0 {
+			adminError(conn, "invalid duration")
+			return
+		}
+
+		var until time.Time
+		var untilUnix int64
+		if duration > 0 {
+			until = time.Now().Add(duration)
+			untilUnix = until.Unix()
+		}
+		if err := t.peerdb.SuspendTrustedSource(vals["name"], until); err != nil {
+			adminError(conn, err.Error())
+			return
+		}
+		adminWrite(conn, map[string]any{"suspended": vals["name"], "until": untilUnix})
+	case "/scope":
+		var hashes []storage.Hash
+		for _, raw := range listParam(vals["hashes"]) {
+			hash, err := storage.ParseHash(raw)
+			if err != nil {
+				adminError(conn, err.Error())
+				return
+			}
+			hashes = append(hashes, hash)
+		}
+		groups := listParam(vals["groups"])
+
+		if err := t.peerdb.ScopeTrustedSource(vals["name"], hashes, groups); err != nil {
+			adminError(conn, err.Error())
+			return
+		}
+		adminWrite(conn, map[string]any{"scoped": vals["name"], "hashes": len(hashes), "groups": groups})
+	default:
+		writeStatus(conn, "404")
+	}
+}
+
+// adminRates serves the transfer rates of the swarm of the hex infohash: /admin/rates?hash=
+func (t *HTTPTracker) adminRates(conn net.Conn, data []byte, p *parsed) {
+	if !authorized(data) {
+		writeStatus(conn, "401")
+		return
+	}
+
+	hash, err := storage.ParseHash(queryParams(p.Params)["hash"])
+	if err != nil {
+		adminError(conn, err.Error())
+		return
+	}
+
+	swarm, peers := t.peerdb.Rates(hash)
+	resp := adminRates{
+		Upload:   swarm.Upload,
+		Download: swarm.Download,
+		Peers:    make([]adminPeerRate, len(peers)),
+	}
+	for i, peer := range peers {
+		resp.Peers[i] = adminPeerRate{
+			ID:       hex.EncodeToString(peer.ID[:]),
+			IP:       peer.IP.String(),
+			Port:     peer.Port,
+			Upload:   peer.Upload,
+			Download: peer.Download,
+		}
+	}
+	adminWrite(conn, resp)
+}
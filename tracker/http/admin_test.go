@@ -0,0 +1,35 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestAuthorized(t *testing.T) {
+	defer func() { config.Config.Admin.Token = "" }()
+
+	var cases = []struct {
+		name    string
+		token   string
+		request string
+		ok      bool
+	}{
+		{"valid", "secret", "GET /admin/sources HTTP/1.1\r\nAuthorization: Bearer secret\r\n\r\n", true},
+		{"wrong", "secret", "GET /admin/sources HTTP/1.1\r\nAuthorization: Bearer secre\r\n\r\n", false},
+		{"caseInsensitive", "secret", "GET /admin/sources HTTP/1.1\r\nauthorization: bearer secret\r\n\r\n", true},
+		{"otherHeader", "secret", "GET /admin/sources HTTP/1.1\r\nX-Authorization: Bearer secret\r\n\r\n", false},
+		{"inBody", "secret", "POST /admin/sources HTTP/1.1\r\n\r\nAuthorization: Bearer secret\r\n", false},
+		{"missing", "secret", "GET /admin/sources HTTP/1.1\r\n\r\n", false},
+		{"disabled", "", "GET /admin/sources HTTP/1.1\r\nAuthorization: Bearer \r\n\r\n", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.Config.Admin.Token = c.token
+			if ok := authorized([]byte(c.request)); ok != c.ok {
+				t.Errorf("authorized() = %v, want %v", ok, c.ok)
+			}
+		})
+	}
+}
@@ -1,30 +1,40 @@
 package http
 
 import (
-	"fmt"
+	"encoding/hex"
 	"math/rand"
 	"net"
 	"net/netip"
 	"strconv"
+	"time"
 
 	"github.com/crimist/trakx/pools"
 	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/stats"
 	"github.com/crimist/trakx/tracker/storage"
+	"go.uber.org/zap"
 )
 
 type announceParams struct {
 	compact          bool
 	nopeerid         bool
 	noneleft         bool
+	left             int64
 	event            string
 	port             string
 	hash             string
 	peerid           string
+	ipv4             string // BEP 7 addresses of dual-stack peers
+	ipv6             string
 	numwant          string
+	numbaseline      string
 	uploaded         int64
 	downloaded       int64
 	baselineProvider bool
+	source           string
+	timestamp        int64
+	signature        string
+	capacity         uint16
 }
 
 func (t *HTTPTracker) announce(conn net.Conn, vals *announceParams, ip netip.Addr) {
@@ -50,7 +60,17 @@ func (t *HTTPTracker) announce(conn net.Conn, vals *announceParams, ip netip.Add
 
 	// get if stop before continuing
 	if vals.event == "stopped" {
-		t.peerdb.Drop(hash, peerid, vals.baselineProvider)
+		// baseline providers are only stopped from the address they registered from
+		var provider netip.AddrPort
+		if vals.baselineProvider {
+			portInt, err := strconv.Atoi(vals.port)
+			if err != nil || (portInt > 65535 || portInt < 1) {
+				t.clientError(conn, "Invalid port")
+				return
+			}
+			provider = netip.AddrPortFrom(ip, uint16(portInt))
+		}
+		t.peerdb.Drop(hash, peerid, provider)
 		conn.Write(httpSuccessBytes)
 		return
 	}
@@ -62,23 +82,24 @@ func (t *HTTPTracker) announce(conn net.Conn, vals *announceParams, ip netip.Add
 		return
 	}
 
-	// numwant
-	numwant := config.Config.Numwant.Default
+	// dual-stack peers give the address of the family they didn't connect from
+	alt, ok := dualStackIP(vals, ip, uint16(portInt))
+	if !ok {
+		t.clientError(conn, "Invalid ipv4 or ipv6")
+		return
+	}
 
-	if vals.numwant != "" {
-		numwantInt, err := strconv.Atoi(vals.numwant)
-		if err != nil || numwantInt < 0 {
-			t.clientError(conn, "Invalid numwant")
-			return
-		}
-		numwantUint := uint(numwantInt)
+	// numwant
+	numwant, ok := parseNumwant(vals.numwant, config.Config.Numwant.Default, config.Config.Numwant.Limit)
+	if !ok {
+		t.clientError(conn, "Invalid numwant")
+		return
+	}
 
-		// if numwant is within our limit than listen to the client
-		if numwantUint <= config.Config.Numwant.Limit {
-			numwant = numwantUint
-		} else {
-			numwant = config.Config.Numwant.Limit
-		}
+	numbaseline, ok := parseNumwant(vals.numbaseline, config.Config.Baseline.Numwant.Default, config.Config.Baseline.Numwant.Limit)
+	if !ok {
+		t.clientError(conn, "Invalid numbaseline")
+		return
 	}
 
 	peerComplete := false
@@ -90,41 +111,88 @@ func (t *HTTPTracker) announce(conn net.Conn, vals *announceParams, ip netip.Add
 	uploaded := vals.uploaded
 	downloaded := vals.downloaded
 
-	goodActing := t.peerdb.Save(ip, uint16(portInt), peerComplete, hash, peerid, uploaded, downloaded, vals.baselineProvider)
+	// refuse banned bad actors, baseline providers are never bad actors
+	var penalty storage.Penalty
+	if !vals.baselineProvider {
+		penalty = t.peerdb.Penalty(ip)
+		if penalty.Banned(time.Now().Unix()) {
+			stats.BannedAnnounces.Add(1)
+			t.clientError(conn, "Banned for bad acting")
+			return
+		}
+	}
+
+	// baseline providers present the credentials of their trusted source
+	var claim *storage.ProviderClaim
+	if vals.baselineProvider {
+		signature, err := hex.DecodeString(vals.signature)
+		if err != nil {
+			t.clientError(conn, "Invalid signature")
+			return
+		}
+		sent, _ := strconv.ParseUint(vals.numbaseline, 10, 32)
+		claim = &storage.ProviderClaim{
+			Source:      vals.source,
+			Timestamp:   vals.timestamp,
+			Signature:   signature,
+			Capacity:    vals.capacity,
+			Event:       announceEvent(vals.event),
+			NumBaseline: uint32(sent),
+		}
+	}
+
+	goodActing := t.peerdb.Save(ip, alt, uint16(portInt), peerComplete, vals.event == "completed", hash, peerid, uploaded, downloaded, vals.left, claim)
 	// Punish the "fraud" baseline provider by just ignoring the request
 	if !goodActing && vals.baselineProvider {
-		fmt.Println("Fraud caught haha!")
+		config.Logger.Warn("Ignored untrusted baseline provider", zap.String("source", vals.source), zap.String("hash", hex.EncodeToString(hash[:])), zap.Stringer("ip", ip))
 		return
 	}
+	// the offence was just recorded so the penalty escalates
+	if !goodActing {
+		penalty = t.peerdb.Penalty(ip)
+	}
+	numwant = penalty.Numwant(numwant)
+	requester := storage.Requester{ID: peerid, IP: ip, Complete: peerComplete, Penalty: penalty}
 
-	complete, incomplete := t.peerdb.HashStats(hash)
+	complete, incomplete, _ := t.peerdb.HashStats(hash)
 
 	interval := int64(config.Config.Announce.Base.Seconds())
 	if int32(config.Config.Announce.Fuzz.Seconds()) > 0 {
 		interval += rand.Int63n(int64(config.Config.Announce.Fuzz.Seconds()))
 	}
+	interval = penalty.Interval(interval)
 
 	dictionary := pools.Dictionaries.Get()
 	dictionary.Int64("interval", interval)
 	dictionary.Int64("complete", int64(complete))
 	dictionary.Int64("incomplete", int64(incomplete))
 	if vals.compact {
-		peers4, peers6 := t.peerdb.PeerListBytes(hash, numwant)
+		peers4, peers6 := t.peerdb.PeerListBytes(hash, requester, numwant)
 		dictionary.StringBytes("peers", peers4)
 		dictionary.StringBytes("peers6", peers6)
 
 		pools.Peerlists4.Put(peers4)
 		pools.Peerlists6.Put(peers6)
 	} else {
-		dictionary.BytesliceSlice("peers", t.peerdb.PeerList(hash, numwant, vals.nopeerid))
+		dictionary.BytesliceSlice("peers", t.peerdb.PeerList(hash, requester, numwant, vals.nopeerid))
 	}
 
 	// For peers that are not a complete baseline provider (can be any peer or be a baseline provider that just leeches first)
-	// provide a random complete baseline provider if one exists
-	if !vals.baselineProvider || !peerComplete {
-		baselineProvider, err := t.peerdb.BaselineProvider(hash, vals.compact, vals.nopeerid)
-		if err == nil {
-			dictionary.StringBytes("baselineProvider", baselineProvider)
+	// provide complete baseline providers if any exist, they aren't withheld as a penalty and the handout rules allow it
+	// `baselineProvider` holds the first pick for older clients
+	handout := vals.baselineProvider || (!penalty.WithholdBaseline() && t.peerdb.HandoutBaseline(hash, peerid, penalty))
+	if (!vals.baselineProvider || !peerComplete) && handout {
+		providers := t.peerdb.BaselineProviders(hash, peerid, numbaseline, vals.compact, vals.nopeerid)
+		if len(providers) > 0 {
+			dictionary.StringBytes("baselineProvider", providers[0])
+
+			if vals.compact {
+				providers4, providers6 := splitCompact(providers)
+				dictionary.StringBytes("baselineProviders", providers4)
+				dictionary.StringBytes("baselineProviders6", providers6)
+			} else {
+				dictionary.BytesliceSlice("baselineProviders", providers)
+			}
 		}
 	}
 
@@ -135,3 +203,91 @@ func (t *HTTPTracker) announce(conn net.Conn, vals *announceParams, ip netip.Add
 	conn.Write(append(httpSuccessBytes, dictionary.GetBytes()...))
 	pools.Dictionaries.Put(dictionary)
 }
+
+// announceEvent numbers the event as baseline providers sign it
+func announceEvent(event string) uint8 {
+	switch event {
+	case "completed":
+		return storage.EventCompleted
+	case "started":
+		return storage.EventStarted
+	case "stopped":
+		return storage.EventStopped
+	}
+	return storage.EventNone
+}
+
+// parseNumwant parses a requested number of entries, returning def if none is requested and capping it at limit
+func parseNumwant(raw string, def uint, limit uint) (uint, bool) {
+	if raw == "" {
+		return def, true
+	}
+
+	numwant, err := strconv.Atoi(raw)
+	if err != nil || numwant < 0 {
+		return 0, false
+	}
+
+	// if numwant is within our limit than listen to the client
+	if uint(numwant) > limit {
+		return limit, true
+	}
+	return uint(numwant), true
+}
+
+// splitCompact splits compact encoded entries into IPv4 and IPv6 lists, keeping their order
+func splitCompact(entries [][]byte) (entries4 []byte, entries6 []byte) {
+	for _, entry := range entries {
+		if len(entry) == 18 {
+			entries6 = append(entries6, entry...)
+		} else {
+			entries4 = append(entries4, entry...)
+		}
+	}
+	return
+}
+
+// dualStackIP returns the address of the other family than ip given by the ipv4 or ipv6 parameter (BEP 7), invalid if there is none.
+// The parameter of the family the peer connected from is checked but the connection address is kept.
+func dualStackIP(vals *announceParams, ip netip.Addr, port uint16) (alt netip.Addr, ok bool) {
+	params := [...]struct {
+		val string
+		is4 bool
+	}{{vals.ipv4, true}, {vals.ipv6, false}}
+
+	for _, param := range params {
+		if param.val == "" {
+			continue
+		}
+		addr, ok := parseStackIP(param.val, param.is4, port)
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if param.is4 != ip.Is4() {
+			alt = addr
+		}
+	}
+
+	return alt, true
+}
+
+// parseStackIP parses an ipv4 or ipv6 parameter, an address optionally followed by the announced port.
+// Only unicast addresses of the named family that may be reached from other hosts are accepted.
+func parseStackIP(val string, is4 bool, port uint16) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(val)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(val)
+		if err != nil || addrPort.Port() != port {
+			return netip.Addr{}, false
+		}
+		ip = addrPort.Addr()
+	}
+
+	if ip.Is4In6() && is4 {
+		ip = ip.Unmap()
+	}
+	if ip.Is4() != is4 || ip.Is4In6() || ip.Zone() != "" || !ip.IsGlobalUnicast() {
+		return netip.Addr{}, false
+	}
+	return ip, true
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"math/rand"
 	"net/netip"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,25 +19,36 @@ import (
 
 // go build -gcflags '-m' -o /dev/null ./... |& grep "moved to heap:"
 
+var (
+	testStorage     storage.Database
+	testStorageErr  error
+	testStorageOnce sync.Once
+)
+
+// openStorage opens the storage shared by the tests of the package, tests use distinct infohashes
+func openStorage(t *testing.T) storage.Database {
+	testStorageOnce.Do(func() {
+		config.Config.DB.Type = "gomap"
+		config.Config.DB.Backup.Type = "none"
+		pools.Initialize(10)
+		testStorage, testStorageErr = storage.Open()
+	})
+	if testStorageErr != nil {
+		t.Fatal("failed to open storage", testStorageErr)
+	}
+	return testStorage
+}
+
 func TestAnnounce(t *testing.T) {
 	rand.Seed(1) // golang default
 
 	// setup config
-	config.Config.DB.Type = "gomap"
-	config.Config.DB.Backup.Type = "none"
 	config.Config.Announce.Base = 10 * time.Second
 	config.Config.Announce.Fuzz = 0
 	config.Config.Numwant.Limit = 10
 
-	// setup pools
-	pools.Initialize(10)
-
 	// setup db
-	db, err := storage.Open()
-	if err != nil {
-		t.Error("failed to open storage", err)
-		t.FailNow()
-	}
+	db := openStorage(t)
 
 	// setup tracker
 	tracker := HTTPTracker{}
@@ -69,7 +81,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("1.1.1.1"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peersl59:d7:peer id20:111111111111111111112:ip7:1.1.1.14:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peerslee"),
 			},
 		},
 		{
@@ -86,8 +98,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("2.2.2.2"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl59:d7:peer id20:111111111111111111112:ip7:1.1.1.14:porti1234ee59:d7:peer id20:222222222222222222222:ip7:2.2.2.24:porti4321eeee"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl59:d7:peer id20:222222222222222222222:ip7:2.2.2.24:porti4321ee59:d7:peer id20:111111111111111111112:ip7:1.1.1.14:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl59:d7:peer id20:111111111111111111112:ip7:1.1.1.14:porti1234eeee"),
 			},
 		},
 		{
@@ -104,7 +115,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("::1234"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peersl58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peerslee"),
 			},
 		},
 		{
@@ -121,8 +132,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("::5678"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234ee58:d7:peer id20:222222222222222222222:ip6:::56784:porti4321eeee"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl58:d7:peer id20:222222222222222222222:ip6:::56784:porti4321ee58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234eeee"),
 			},
 		},
 		{
@@ -139,8 +149,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("1.1.1.1"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234ee59:d7:peer id20:222222222222222222222:ip7:1.1.1.14:porti4321eeee"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl59:d7:peer id20:222222222222222222222:ip7:1.1.1.14:porti4321ee58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl58:d7:peer id20:111111111111111111112:ip6:::12344:porti1234eeee"),
 			},
 		},
 		{
@@ -157,7 +166,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("1.1.1.1"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peersl27:d2:ip7:1.1.1.14:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peerslee"),
 			},
 		},
 		{
@@ -174,8 +183,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("2.2.2.2"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl27:d2:ip7:1.1.1.14:porti1234ee27:d2:ip7:2.2.2.24:porti4321eeee"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl27:d2:ip7:2.2.2.24:porti4321ee27:d2:ip7:1.1.1.14:porti1234eeee"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peersl27:d2:ip7:1.1.1.14:porti1234eeee"),
 			},
 		},
 		{
@@ -192,7 +200,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("1.1.1.1"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peers6:\x01\x01\x01\x01\x04\xd26:peers60:e"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peers0:6:peers60:e"),
 			},
 		},
 		{
@@ -209,8 +217,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("2.2.2.2"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers12:\x01\x01\x01\x01\x04\xd2\x02\x02\x02\x02\x10\xe16:peers60:e"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers12:\x02\x02\x02\x02\x10\xe1\x01\x01\x01\x01\x04\xd26:peers60:e"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers6:\x01\x01\x01\x01\x04\xd26:peers60:e"),
 			},
 		},
 		{
@@ -227,7 +234,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("::1234"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peers0:6:peers618:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2e"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peers0:6:peers60:e"),
 			},
 		},
 		{
@@ -244,8 +251,7 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("::5678"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers0:6:peers636:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x56\x78\x04\xd2e"),
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers0:6:peers636:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x56\x78\x04\xd2\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2e"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers0:6:peers618:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2e"),
 			},
 		},
 		{
@@ -262,7 +268,60 @@ func TestAnnounce(t *testing.T) {
 			},
 			netip.MustParseAddr("1.1.1.1"),
 			[][]byte{
-				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers6:\x01\x01\x01\x01\x04\xd26:peers618:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2e"),
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers0:6:peers618:\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x34\x04\xd2e"),
+			},
+		},
+		{
+			"compactDualStack",
+			announceParams{
+				compact:  true,
+				nopeerid: false,
+				noneleft: false,
+				event:    "started",
+				port:     "1234",
+				hash:     "44444444444444444444",
+				peerid:   "11111111111111111111",
+				ipv6:     "[2001:db8::1]:1234",
+				numwant:  "10",
+			},
+			netip.MustParseAddr("1.1.1.1"),
+			[][]byte{
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei1e5:peers0:6:peers60:e"),
+			},
+		},
+		{
+			"compactDualStackMulti",
+			announceParams{
+				compact:  true,
+				nopeerid: false,
+				noneleft: false,
+				event:    "started",
+				port:     "4321",
+				hash:     "44444444444444444444",
+				peerid:   "22222222222222222222",
+				numwant:  "10",
+			},
+			netip.MustParseAddr("2.2.2.2"),
+			[][]byte{
+				[]byte("HTTP/1.1 200\r\n\r\nd8:intervali10e8:completei0e10:incompletei2e5:peers6:\x01\x01\x01\x01\x04\xd26:peers618:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x04\xd2e"),
+			},
+		},
+		{
+			"invalidDualStack",
+			announceParams{
+				compact:  true,
+				nopeerid: false,
+				noneleft: false,
+				event:    "started",
+				port:     "1234",
+				hash:     "44444444444444444444",
+				peerid:   "33333333333333333333",
+				ipv6:     "::1",
+				numwant:  "10",
+			},
+			netip.MustParseAddr("3.3.3.3"),
+			[][]byte{
+				[]byte("HTTP/1.1 200\r\n\r\nd14:failure reason20:Invalid ipv4 or ipv6e"),
 			},
 		},
 	}
@@ -293,3 +352,40 @@ func TestAnnounce(t *testing.T) {
 		})
 	}
 }
+
+func TestParseStackIP(t *testing.T) {
+	cases := []struct {
+		val  string
+		is4  bool
+		want string
+	}{
+		{"1.2.3.4", true, "1.2.3.4"},
+		{"1.2.3.4:1234", true, "1.2.3.4"},
+		{"::ffff:1.2.3.4", true, "1.2.3.4"},
+		{"2001:db8::1", false, "2001:db8::1"},
+		{"[2001:db8::1]:1234", false, "2001:db8::1"},
+		{"1.2.3.4:4321", true, ""},
+		{"2001:db8::1", true, ""},
+		{"1.2.3.4", false, ""},
+		{"::ffff:1.2.3.4", false, ""},
+		{"fe80::1%eth0", false, ""},
+		{"127.0.0.1", true, ""},
+		{"::1", false, ""},
+		{"0.0.0.0", true, ""},
+		{"224.0.0.1", true, ""},
+		{"example.com", true, ""},
+	}
+
+	for _, c := range cases {
+		ip, ok := parseStackIP(c.val, c.is4, 1234)
+		if c.want == "" {
+			if ok {
+				t.Errorf("parseStackIP(%q, %v) = %v, want invalid", c.val, c.is4, ip)
+			}
+			continue
+		}
+		if !ok || ip != netip.MustParseAddr(c.want) {
+			t.Errorf("parseStackIP(%q, %v) = %v, %v, want %v", c.val, c.is4, ip, ok, c.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/storage"
@@ -11,28 +12,31 @@ import (
 
 const (
 	httpRequestMax = 2600 // enough for scrapes up to 40 info_hashes
+	adminThreads   = 2
 )
 
 type HTTPTracker struct {
 	peerdb   storage.Database
 	workers  workers
+	admin    workers // serves the admin api apart from the tracker, empty if disabled
 	shutdown chan struct{}
-	clientTorrentHashToDownload map[string]int
-	clientTorrentHashToUpload map[string]int
-	downloadSpeed int
-	uploadSpeed int
+	names    map[storage.Hash]string // torrent names given in scrape responses
 }
 
 // Init sets up the HTTPTracker.
 func (t *HTTPTracker) Init(peerdb storage.Database) {
 	t.peerdb = peerdb
 	t.shutdown = make(chan struct{})
-	t.clientTorrentHashToDownload = make(map[string]int)
-	t.clientTorrentHashToUpload = make(map[string]int)
 }
 
 // Serve begins listening and serving clients.
 func (t *HTTPTracker) Serve() error {
+	names, err := parseNames(config.Config.Scrape.Names)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse scrape names")
+	}
+	t.names = names
+
 	ln, err := net.Listen("tcp", fmt.Sprintf("%v:%v", config.Config.HTTP.IP, config.Config.HTTP.Port))
 	if err != nil {
 		return errors.Wrap(err, "Failed to open TCP listen socket")
@@ -51,10 +55,30 @@ func (t *HTTPTracker) Serve() error {
 
 	t.workers.startWorkers(config.Config.HTTP.Threads)
 
+	// the admin api changes the tracker's state, it's kept off the tracker port
+	if config.Config.Admin.Token != "" && config.Config.Admin.Port != 0 {
+		adminLn, err := net.Listen("tcp", net.JoinHostPort(config.Config.Admin.IP, strconv.Itoa(config.Config.Admin.Port)))
+		if err != nil {
+			ln.Close()
+			return errors.Wrap(err, "Failed to open admin TCP listen socket")
+		}
+		t.admin = workers{
+			tracker:  t,
+			listener: adminLn,
+			admin:    true,
+		}
+		t.admin.startWorkers(adminThreads)
+	}
+
 	<-t.shutdown
 	if err := ln.Close(); err != nil {
 		return errors.Wrap(err, "Failed to close tcp listen socket")
 	}
+	if t.admin.listener != nil {
+		if err := t.admin.listener.Close(); err != nil {
+			return errors.Wrap(err, "Failed to close admin tcp listen socket")
+		}
+	}
 
 	return nil
 }
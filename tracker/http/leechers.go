@@ -0,0 +1,86 @@
+package http
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// leechers serves the authorised leechers of a baseline provider: /leechers?info_hash=&peer_id=&port=&source=&timestamp=&signature=&compact=
+// The provider authenticates like it does when announcing, signing storage.LeechersMessage instead of the announce.
+func (t *HTTPTracker) leechers(conn net.Conn, p params, ip netip.Addr) {
+	vals := queryParams(p)
+
+	var hash storage.Hash
+	var peerid storage.PeerID
+	if len(vals["info_hash"]) != 20 {
+		t.clientError(conn, "Invalid infohash")
+		return
+	}
+	copy(hash[:], vals["info_hash"])
+	if len(vals["peer_id"]) != 20 {
+		t.clientError(conn, "Invalid peerid")
+		return
+	}
+	copy(peerid[:], vals["peer_id"])
+
+	port, err := strconv.ParseUint(vals["port"], 10, 16)
+	if err != nil || port == 0 {
+		t.clientError(conn, "Invalid port")
+		return
+	}
+
+	signature, err := hex.DecodeString(vals["signature"])
+	if err != nil {
+		t.clientError(conn, "Invalid signature")
+		return
+	}
+	timestamp, _ := strconv.ParseInt(vals["timestamp"], 10, 64)
+	claim := storage.ProviderClaim{
+		Source:    vals["source"],
+		Timestamp: timestamp,
+		Signature: signature,
+	}
+
+	leechers, err := t.peerdb.AuthorizedLeechers(ip, uint16(port), hash, peerid, &claim)
+	if err != nil {
+		t.clientError(conn, err.Error())
+		return
+	}
+
+	dictionary := pools.Dictionaries.Get()
+	if vals["compact"] == "1" {
+		var peers4, peers6 []byte
+		for _, leecher := range leechers {
+			if leecher.IP.Is6() {
+				peers6 = append(peers6, leecher.IP.AsSlice()...)
+				peers6 = binary.BigEndian.AppendUint16(peers6, leecher.Port)
+			} else {
+				peers4 = append(peers4, leecher.IP.AsSlice()...)
+				peers4 = binary.BigEndian.AppendUint16(peers4, leecher.Port)
+			}
+		}
+		dictionary.StringBytes("peers", peers4)
+		dictionary.StringBytes("peers6", peers6)
+	} else {
+		peers := make([][]byte, len(leechers))
+		peer := pools.Dictionaries.Get()
+		for i, leecher := range leechers {
+			peer.String("peer id", string(leecher.ID[:]))
+			peer.String("ip", leecher.IP.String())
+			peer.Int64("port", int64(leecher.Port))
+			peers[i] = append([]byte(nil), peer.GetBytes()...)
+			peer.Reset()
+		}
+		pools.Dictionaries.Put(peer)
+		dictionary.BytesliceSlice("peers", peers)
+	}
+
+	conn.Write(append(httpSuccessBytes, dictionary.GetBytes()...))
+	pools.Dictionaries.Put(dictionary)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// report serves misbehaviour reports: /report?info_hash=&peer_id=&port=&type=&target_id=&target=
+// The reported peer is identified by its peer ID (target_id) or endpoint (target, "ip:port").
+// Trusted sources add baselineProvider=1 with their source, timestamp and signature over storage.Report.Message.
+func (t *HTTPTracker) report(conn net.Conn, p params, ip netip.Addr) {
+	vals := queryParams(p)
+
+	report := storage.Report{}
+	if len(vals["info_hash"]) != 20 {
+		t.clientError(conn, "Invalid infohash")
+		return
+	}
+	copy(report.Hash[:], vals["info_hash"])
+	if len(vals["peer_id"]) != 20 {
+		t.clientError(conn, "Invalid peerid")
+		return
+	}
+	copy(report.Reporter[:], vals["peer_id"])
+
+	port, err := strconv.ParseUint(vals["port"], 10, 16)
+	if err != nil || port == 0 {
+		t.clientError(conn, "Invalid port")
+		return
+	}
+	report.Port = uint16(port)
+
+	if report.Type, err = storage.ParseReportType(vals["type"]); err != nil {
+		t.clientError(conn, err.Error())
+		return
+	}
+
+	if target, ok := vals["target_id"]; ok {
+		if len(target) != 20 {
+			t.clientError(conn, "Invalid target_id")
+			return
+		}
+		copy(report.Target[:], target)
+	} else {
+		if report.Endpoint, err = netip.ParseAddrPort(vals["target"]); err != nil {
+			t.clientError(conn, "Invalid target")
+			return
+		}
+	}
+
+	var claim *storage.ProviderClaim
+	if vals["baselineProvider"] == "1" {
+		signature, err := hex.DecodeString(vals["signature"])
+		if err != nil {
+			t.clientError(conn, "Invalid signature")
+			return
+		}
+		timestamp, _ := strconv.ParseInt(vals["timestamp"], 10, 64)
+		claim = &storage.ProviderClaim{
+			Source:    vals["source"],
+			Timestamp: timestamp,
+			Signature: signature,
+		}
+	}
+
+	if err := t.peerdb.Report(ip, &report, claim); err != nil {
+		t.clientError(conn, err.Error())
+		return
+	}
+
+	conn.Write(httpSuccessBytes)
+}
@@ -4,10 +4,26 @@ import (
 	"net"
 
 	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/stats"
 	"github.com/crimist/trakx/tracker/storage"
+	"github.com/pkg/errors"
 )
 
+// parseNames parses the torrent names given in scrape responses, keyed by hex infohash
+func parseNames(raw map[string]string) (map[storage.Hash]string, error) {
+	names := make(map[storage.Hash]string, len(raw))
+	for key, name := range raw {
+		hash, err := storage.ParseHash(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid scrape name infohash '"+key+"'")
+		}
+		names[hash] = name
+	}
+	return names, nil
+}
+
+// scrape writes the BEP 48 scrape response of the infohashes
 func (t *HTTPTracker) scrape(conn net.Conn, infohashes params) {
 	stats.Scrapes.Add(1)
 
@@ -25,18 +41,27 @@ func (t *HTTPTracker) scrape(conn net.Conn, infohashes params) {
 
 		var hash storage.Hash
 		copy(hash[:], infohash)
-		complete, incomplete := t.peerdb.HashStats(hash)
+		complete, incomplete, downloaded := t.peerdb.HashStats(hash)
 
+		// keys in sorted order as bencoding requires
 		dictionary.StartDictionaryBytes(infohash)
 		{
 			dictionary.Int64("complete", int64(complete))
+			dictionary.Int64("downloaded", int64(downloaded))
 			dictionary.Int64("incomplete", int64(incomplete))
+			if name, ok := t.names[hash]; ok {
+				dictionary.String("name", name)
+			}
 		}
 		dictionary.EndDictionary()
 	}
 
 	dictionary.EndDictionary()
 
+	dictionary.StartDictionary("flags")
+	dictionary.Int64("min_request_interval", int64(config.Config.Scrape.Interval.Seconds()))
+	dictionary.EndDictionary()
+
 	// conn.Write(httpSuccessBytes)
 	// conn.Write(d.GetBytes())
 
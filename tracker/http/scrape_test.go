@@ -0,0 +1,68 @@
+package http
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/cbeuw/connutil"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+
+	_ "github.com/crimist/trakx/tracker/storage/map"
+)
+
+func TestScrape(t *testing.T) {
+	original := config.Config.Scrape
+	defer func() { config.Config.Scrape = original }()
+	config.Config.Scrape.Interval = time.Minute
+
+	db := openStorage(t)
+
+	named := storage.Hash{'s', 'c', 'r', 'a', 'p', 'e'}
+	unknown := storage.Hash{'u', 'n', 'k', 'n', 'o', 'w', 'n'}
+	names, err := parseNames(map[string]string{hex.EncodeToString(named[:]): "test.iso"})
+	if err != nil {
+		t.Fatal("parseNames() failed", err)
+	}
+
+	ip := netip.MustParseAddr("1.2.3.4")
+	db.Save(ip, netip.Addr{}, 1000, false, false, named, storage.PeerID{1}, 0, 0, 100, nil)
+	db.Save(ip, netip.Addr{}, 1000, true, true, named, storage.PeerID{1}, 0, 100, 0, nil)
+	db.Save(ip, netip.Addr{}, 1001, false, false, named, storage.PeerID{2}, 0, 0, 100, nil)
+
+	tracker := HTTPTracker{peerdb: db, names: names}
+	client, server := connutil.AsyncPipe()
+	defer func() {
+		client.Close()
+		server.Close()
+	}()
+
+	var infohashes params
+	infohashes[0] = named[:]
+	infohashes[1] = unknown[:]
+	tracker.scrape(client, infohashes)
+
+	resp := make([]byte, 0xFFFF)
+	respSize, err := server.Read(resp)
+	if err != nil {
+		t.Fatal("Error reading asyncpipe")
+	}
+	resp = resp[:respSize]
+
+	expected := []byte("HTTP/1.1 200\r\n\r\nd5:filesd" +
+		"20:" + string(named[:]) + "d8:completei1e10:downloadedi1e10:incompletei1e4:name8:test.isoe" +
+		"20:" + string(unknown[:]) + "d8:completei0e10:downloadedi0e10:incompletei0ee" +
+		"e5:flagsd20:min_request_intervali60eee")
+	if !bytes.Equal(resp, expected) {
+		t.Errorf("bad scrape\nresp:\n%v\nexpected:\n%v", hex.Dump(resp), hex.Dump(expected))
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	if _, err := parseNames(map[string]string{"not a hash": "test.iso"}); err == nil {
+		t.Error("parseNames() accepted an invalid infohash")
+	}
+}
@@ -19,6 +19,7 @@ type workers struct {
 	tracker   *HTTPTracker
 	listener  net.Listener
 	fileCache config.EmbeddedCache
+	admin     bool // serve the admin api instead of the tracker
 }
 
 func (w *workers) startWorkers(num int) {
@@ -74,6 +75,12 @@ func (w *workers) work() {
 			continue
 		}
 
+		if w.admin {
+			w.tracker.serveAdmin(conn, data[:size], &p)
+			conn.Close()
+			continue
+		}
+
 		switch p.Path {
 		case "/announce":
 			var v announceParams
@@ -101,6 +108,7 @@ func (w *workers) work() {
 					if val == "0" {
 						v.noneleft = true
 					}
+					v.left, _ = strconv.ParseInt(val, 10, 64)
 				case "event":
 					v.event = val
 				case "port":
@@ -109,8 +117,14 @@ func (w *workers) work() {
 					v.hash = val
 				case "peer_id":
 					v.peerid = val
+				case "ipv4":
+					v.ipv4 = val
+				case "ipv6":
+					v.ipv6 = val
 				case "numwant":
 					v.numwant = val
+				case "numbaseline":
+					v.numbaseline = val
 				case "uploaded":
 					v.uploaded, _ = strconv.ParseInt(val, 10, 64)
 				case "downloaded":
@@ -119,27 +133,20 @@ func (w *workers) work() {
 					if val == "1" {
 						v.baselineProvider = true
 					}
+				case "source":
+					v.source = val
+				case "timestamp":
+					v.timestamp, _ = strconv.ParseInt(val, 10, 64)
+				case "signature":
+					v.signature = val
+				case "capacity":
+					capacity, _ := strconv.ParseUint(val, 10, 16)
+					v.capacity = uint16(capacity)
 				}
 			}
 
-			var ip netip.Addr
-			var ipStr string
-
-			forwarded, forwardedIP := parseForwarded(data)
-			if forwarded {
-				if forwardedIP == nil {
-					w.tracker.clientError(conn, "Failed to parse X-Forwarded-For")
-					break
-				}
-				ipStr = *(*string)(unsafe.Pointer(&forwardedIP))
-			} else {
-				ipStr, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
-			}
-
-			ip, err := netip.ParseAddr(ipStr)
-			if err != nil {
-				config.Logger.Warn("Failed to parse value from X-Forwarded-For", zap.String("ip string", ipStr), zap.Error(err))
-				w.tracker.clientError(conn, "Failed to parse forwarded IP")
+			ip, ok := w.tracker.clientIP(conn, data)
+			if !ok {
 				break
 			}
 
@@ -159,6 +166,20 @@ func (w *workers) work() {
 				break
 			}
 			w.tracker.scrape(conn, p.Params)
+		case "/leechers":
+			ip, ok := w.tracker.clientIP(conn, data)
+			if !ok {
+				break
+			}
+
+			w.tracker.leechers(conn, p.Params, ip)
+		case "/report":
+			ip, ok := w.tracker.clientIP(conn, data)
+			if !ok {
+				break
+			}
+
+			w.tracker.report(conn, p.Params, ip)
 		case "/heartbeat":
 			writeStatus(conn, "200")
 		case "/stats":
@@ -180,3 +201,28 @@ func (w *workers) work() {
 		conn.Close()
 	}
 }
+
+// clientIP returns the address of the client, taken from X-Forwarded-For if present. Failures are written to the client.
+func (t *HTTPTracker) clientIP(conn net.Conn, data []byte) (netip.Addr, bool) {
+	var ipStr string
+
+	forwarded, forwardedIP := parseForwarded(data)
+	if forwarded {
+		if forwardedIP == nil {
+			t.clientError(conn, "Failed to parse X-Forwarded-For")
+			return netip.Addr{}, false
+		}
+		ipStr = *(*string)(unsafe.Pointer(&forwardedIP))
+	} else {
+		ipStr, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	}
+
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		config.Logger.Warn("Failed to parse value from X-Forwarded-For", zap.String("ip string", ipStr), zap.Error(err))
+		t.clientError(conn, "Failed to parse forwarded IP")
+		return netip.Addr{}, false
+	}
+
+	return ip, true
+}
@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PolicyVerdicts counts how the verdicts of a shadow behavior policy compare to the active policy.
+type PolicyVerdicts struct {
+	Agree    atomic.Int64 // same verdict as the active policy
+	Disagree atomic.Int64 // different verdict than the active policy
+	Flagged  atomic.Int64 // announces judged bad acting
+}
+
+var (
+	shadowMutex    sync.Mutex
+	shadowVerdicts = make(map[string]*PolicyVerdicts)
+)
+
+// ShadowVerdicts returns the verdict counters of the named shadow policy.
+func ShadowVerdicts(policy string) *PolicyVerdicts {
+	shadowMutex.Lock()
+	defer shadowMutex.Unlock()
+
+	verdicts, ok := shadowVerdicts[policy]
+	if !ok {
+		verdicts = new(PolicyVerdicts)
+		shadowVerdicts[policy] = verdicts
+	}
+	return verdicts
+}
+
+// eachShadowVerdicts calls fn with the verdict counters of every shadow policy.
+func eachShadowVerdicts(fn func(policy string, verdicts *PolicyVerdicts)) {
+	shadowMutex.Lock()
+	defer shadowMutex.Unlock()
+
+	for policy, verdicts := range shadowVerdicts {
+		fn(policy, verdicts)
+	}
+}
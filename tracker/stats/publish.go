@@ -31,14 +31,48 @@ func Publish(peerdb storage.Database, udpconns func() int64) {
 	ips := expvar.NewInt("trakx.database.ips")
 	hashes := expvar.NewInt("trakx.database.hashes")
 	udpConnections := expvar.NewInt("trakx.database.udpconnections")
+	uploadRate := expvar.NewInt("trakx.database.uploadrate")
+	downloadRate := expvar.NewInt("trakx.database.downloadrate")
+	expired := expvar.NewInt("trakx.database.expired")
+	expiryLag := expvar.NewInt("trakx.database.expirylag")
+
+	// database limits
+	rejectedPeers := expvar.NewInt("trakx.limits.rejected.peers")
+	rejectedSwarms := expvar.NewInt("trakx.limits.rejected.swarms")
+	rejectedSwarmPeers := expvar.NewInt("trakx.limits.rejected.swarmpeers")
+	rejectedIPSwarms := expvar.NewInt("trakx.limits.rejected.ipswarms")
+	evictedPeers := expvar.NewInt("trakx.limits.evicted.peers")
+	evictedSwarmPeers := expvar.NewInt("trakx.limits.evicted.swarmpeers")
 
 	// errors
 	serverErrors := expvar.NewInt("trakx.errors.server")
 	clientErrors := expvar.NewInt("trakx.errors.client")
+	providerAuthFailures := expvar.NewInt("trakx.errors.providerauth")
+	providerReplays := expvar.NewInt("trakx.errors.providerreplays")
+
+	// baseline providers
+	baselineWithheld := expvar.NewInt("trakx.baseline.withheld")
+
+	// penalties
+	offences := expvar.NewInt("trakx.penalties.offences")
+	bans := expvar.NewInt("trakx.penalties.bans")
+	bannedAnnounces := expvar.NewInt("trakx.penalties.bannedannounces")
+
+	// peer lists
+	peerListsDemoted := expvar.NewInt("trakx.peerlists.demoted")
+	peerListsOmitted := expvar.NewInt("trakx.peerlists.omitted")
+	peerListsBoosted := expvar.NewInt("trakx.peerlists.boosted")
+
+	// reports
+	sourceReports := expvar.NewInt("trakx.reports.source")
+	peerReports := expvar.NewInt("trakx.reports.peer")
+	reportsRejected := expvar.NewInt("trakx.reports.rejected")
+
+	// shadow behavior policies, "<policy>.agree" "<policy>.disagree" and "<policy>.flagged"
+	shadowPolicies := expvar.NewMap("trakx.policies.shadow")
 
 	// pools
 	dictionaryPool := expvar.NewInt("trakx.pools.dictionaries")
-	peerPool := expvar.NewInt("trakx.pools.peers")
 	peerlist4Pool := expvar.NewInt("trakx.pools.peerlists4")
 	peerlist6Pool := expvar.NewInt("trakx.pools.peerlists6")
 
@@ -59,12 +93,44 @@ func Publish(peerdb storage.Database, udpconns func() int64) {
 		ips.Set(int64(IPStats.Total()))
 		hashes.Set(int64(peerdb.Hashes()))
 		udpConnections.Set(udpconns())
+		uploadRate.Set(UploadRate.Load())
+		downloadRate.Set(DownloadRate.Load())
+		expired.Set(Expired.Load())
+		expiryLag.Set(ExpiryLag.Load())
+
+		rejectedPeers.Set(RejectedPeers.Load())
+		rejectedSwarms.Set(RejectedSwarms.Load())
+		rejectedSwarmPeers.Set(RejectedSwarmPeers.Load())
+		rejectedIPSwarms.Set(RejectedIPSwarms.Load())
+		evictedPeers.Set(EvictedPeers.Load())
+		evictedSwarmPeers.Set(EvictedSwarmPeers.Load())
 
 		serverErrors.Set(ServerErrors.Load())
 		clientErrors.Set(ClientErrors.Load())
+		providerAuthFailures.Set(ProviderAuthFailures.Load())
+		providerReplays.Set(ProviderReplays.Load())
+
+		baselineWithheld.Set(BaselineWithheld.Load())
+
+		offences.Set(Offences.Load())
+		bans.Set(Bans.Load())
+		bannedAnnounces.Set(BannedAnnounces.Load())
+
+		peerListsDemoted.Set(PeerListsDemoted.Load())
+		peerListsOmitted.Set(PeerListsOmitted.Load())
+		peerListsBoosted.Set(PeerListsBoosted.Load())
+
+		sourceReports.Set(SourceReports.Load())
+		peerReports.Set(PeerReports.Load())
+		reportsRejected.Set(ReportsRejected.Load())
+
+		eachShadowVerdicts(func(policy string, verdicts *PolicyVerdicts) {
+			setMapInt(shadowPolicies, policy+".agree", verdicts.Agree.Load())
+			setMapInt(shadowPolicies, policy+".disagree", verdicts.Disagree.Load())
+			setMapInt(shadowPolicies, policy+".flagged", verdicts.Flagged.Load())
+		})
 
 		dictionaryPool.Set(int64(pools.Dictionaries.Created()))
-		peerPool.Set(int64(pools.Peers.Created()))
 		peerlist4Pool.Set(int64(pools.Peerlists4.Created()))
 		peerlist6Pool.Set(int64(pools.Peerlists6.Created()))
 
@@ -78,3 +144,12 @@ func Publish(peerdb storage.Database, udpconns func() int64) {
 		Scrapes.Store(0)
 	})
 }
+
+func setMapInt(m *expvar.Map, key string, value int64) {
+	v, ok := m.Get(key).(*expvar.Int)
+	if !ok {
+		v = new(expvar.Int)
+		m.Set(key, v)
+	}
+	v.Set(value)
+}
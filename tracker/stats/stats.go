@@ -23,7 +23,43 @@ var (
 	Leeches atomic.Int64 // total leeches
 	IPStats ipStats      // total (unique) ips
 
+	// expiry
+	Expired   atomic.Int64 // peers and baseline providers removed after expiring
+	ExpiryLag atomic.Int64 // milliseconds between when the peers removed by the latest expiry pass were due and their removal, at most
+
+	// database limits
+	RejectedPeers      atomic.Int64 // new peers not stored as the database holds DB.Limits.Peers
+	RejectedSwarms     atomic.Int64 // new swarms not created as the database holds DB.Limits.Swarms
+	RejectedSwarmPeers atomic.Int64 // new peers not stored as their swarm holds DB.Limits.SwarmPeers
+	RejectedIPSwarms   atomic.Int64 // new peers not stored as their address is in DB.Limits.IPSwarms swarms
+	EvictedPeers       atomic.Int64 // peers evicted to admit a peer to a swarm with baseline providers when the database is full
+	EvictedSwarmPeers  atomic.Int64 // peers evicted to admit a peer to a full swarm with baseline providers
+
+	// transfer rates
+	UploadRate   atomic.Int64 // sum of the upload rates of every peer in bytes per second
+	DownloadRate atomic.Int64 // sum of the download rates of every peer in bytes per second
+
 	// errors
 	ServerErrors atomic.Int64
 	ClientErrors atomic.Int64
+
+	// baseline providers
+	ProviderAuthFailures atomic.Int64 // baseline provider claims with an unknown source or bad signature
+	ProviderReplays      atomic.Int64 // baseline provider claims with a stale or replayed signature
+	BaselineWithheld     atomic.Int64 // announces not handed baseline providers by the handout rules
+
+	// bad actors
+	Offences        atomic.Int64 // announces detected as bad acting
+	Bans            atomic.Int64 // temporary bans issued
+	BannedAnnounces atomic.Int64 // announces refused from banned addresses
+
+	// peer lists
+	PeerListsDemoted atomic.Int64 // peers with recent offences placed last in a good actor's peer list
+	PeerListsOmitted atomic.Int64 // peers with recent offences left out of a good actor's peer list
+	PeerListsBoosted atomic.Int64 // leecher peer lists given a larger seed share for the reputation of the requester
+
+	// misbehaviour reports
+	SourceReports   atomic.Int64 // reports accepted from trusted sources
+	PeerReports     atomic.Int64 // reports accepted from peers
+	ReportsRejected atomic.Int64 // reports refused as invalid, unauthenticated or rate limited
 )
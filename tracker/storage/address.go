@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+// ParseReliableSource parses the address and ports a keyless trusted source announces from.
+func ParseReliableSource(raw config.RawSocketAddress) (addr ReliableSource, err error) {
+	switch {
+	case raw.IP != "" && raw.Host != "":
+		return addr, errors.New("trusted source may have either an ip or a host")
+	case strings.Contains(raw.IP, "/"):
+		prefix, err := netip.ParsePrefix(raw.IP)
+		if err != nil {
+			return addr, errors.Wrap(err, "failed to parse trusted source prefix")
+		}
+		addr.Prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+	case raw.IP != "":
+		ip, err := netip.ParseAddr(raw.IP)
+		if err != nil {
+			return addr, errors.Wrap(err, "failed to parse trusted source ip")
+		}
+		ip = ip.Unmap()
+		addr.Prefix = netip.PrefixFrom(ip, ip.BitLen())
+	case raw.Host != "":
+		if strings.ContainsAny(raw.Host, " /:") {
+			return addr, errors.New("invalid trusted source host '" + raw.Host + "'")
+		}
+		addr.Host = raw.Host
+	}
+
+	switch {
+	case raw.Ports == "":
+		addr.PortMin, addr.PortMax = raw.Port, raw.Port
+	case raw.Ports == "*":
+		addr.PortMin, addr.PortMax = 0, 0xFFFF
+	default:
+		low, high, ok := strings.Cut(raw.Ports, "-")
+		if !ok {
+			return addr, errors.New("trusted source ports must be \"low-high\" or \"*\"")
+		}
+		portMin, errMin := strconv.ParseUint(low, 10, 16)
+		portMax, errMax := strconv.ParseUint(high, 10, 16)
+		if errMin != nil || errMax != nil || portMin > portMax {
+			return addr, errors.New("invalid trusted source port range '" + raw.Ports + "'")
+		}
+		addr.PortMin, addr.PortMax = uint16(portMin), uint16(portMax)
+	}
+
+	return addr, nil
+}
+
+// IsValid returns true if the source has an address.
+func (addr *ReliableSource) IsValid() bool {
+	return addr.Prefix.IsValid() || addr.Host != ""
+}
+
+// Equal returns true if both match the same addresses and ports.
+func (addr *ReliableSource) Equal(other *ReliableSource) bool {
+	return addr.Prefix == other.Prefix && addr.Host == other.Host && addr.PortMin == other.PortMin && addr.PortMax == other.PortMax
+}
+
+// Match returns true if the source may announce from the ip and port.
+func (addr *ReliableSource) Match(ip netip.Addr, port uint16) bool {
+	if port < addr.PortMin || port > addr.PortMax {
+		return false
+	}
+
+	ip = ip.Unmap()
+	if addr.Host != "" {
+		for _, resolved := range addr.resolved {
+			if resolved == ip {
+				return true
+			}
+		}
+		return false
+	}
+	return addr.Prefix.Contains(ip)
+}
+
+// MoreSpecific returns true if the source matches fewer addresses than other, or as many addresses and fewer ports.
+// Hostnames are as specific as single addresses.
+func (addr *ReliableSource) MoreSpecific(other *ReliableSource) bool {
+	if bits, otherBits := addr.hostBits(), other.hostBits(); bits != otherBits {
+		return bits < otherBits
+	}
+	return addr.PortMax-addr.PortMin < other.PortMax-other.PortMin
+}
+
+// hostBits returns the number of host bits of the prefix, 0 for hostnames and single addresses
+func (addr *ReliableSource) hostBits() int {
+	if addr.Host != "" {
+		return 0
+	}
+	return addr.Prefix.Addr().BitLen() - addr.Prefix.Bits()
+}
+
+// Resolve looks up the addresses of the hostname, sources without a hostname resolve to nothing.
+// The addresses are only used once set with SetResolved.
+func (addr *ReliableSource) Resolve(ctx context.Context) ([]netip.Addr, error) {
+	if addr.Host == "" {
+		return nil, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", addr.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve trusted source host '"+addr.Host+"'")
+	}
+	for i := range ips {
+		ips[i] = ips[i].Unmap()
+	}
+	return ips, nil
+}
+
+// SetResolved sets the addresses the hostname resolved to.
+func (addr *ReliableSource) SetResolved(ips []netip.Addr) {
+	addr.resolved = ips
+}
+
+// Raw converts the address back to its configuration form.
+func (addr *ReliableSource) Raw() (raw config.RawSocketAddress) {
+	if addr.Prefix.IsValid() {
+		if addr.hostBits() == 0 {
+			raw.IP = addr.Prefix.Addr().String()
+		} else {
+			raw.IP = addr.Prefix.String()
+		}
+	}
+	raw.Host = addr.Host
+
+	switch {
+	case addr.PortMin == addr.PortMax:
+		raw.Port = addr.PortMin
+	case addr.PortMin == 0 && addr.PortMax == 0xFFFF:
+		raw.Ports = "*"
+	default:
+		raw.Ports = strconv.Itoa(int(addr.PortMin)) + "-" + strconv.Itoa(int(addr.PortMax))
+	}
+
+	return
+}
+
+// String returns the address and ports, ex: "1.2.3.4:4000", "10.0.0.0/24:*" or "origin.example.com:4000-4100".
+func (addr *ReliableSource) String() string {
+	raw := addr.Raw()
+	if raw.Host == "" && raw.Ports == "" {
+		if ip, err := netip.ParseAddr(raw.IP); err == nil {
+			return netip.AddrPortFrom(ip, raw.Port).String()
+		}
+	}
+
+	host := raw.IP + raw.Host
+	if raw.Ports != "" {
+		return host + ":" + raw.Ports
+	}
+	return host + ":" + strconv.Itoa(int(raw.Port))
+}
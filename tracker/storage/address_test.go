@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestParseReliableSource(t *testing.T) {
+	var cases = []struct {
+		name   string
+		raw    config.RawSocketAddress
+		ok     bool
+		string string
+	}{
+		{"exact", config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, true, "1.2.3.4:4000"},
+		{"mapped", config.RawSocketAddress{IP: "::ffff:1.2.3.4", Port: 4000}, true, "1.2.3.4:4000"},
+		{"ipv6", config.RawSocketAddress{IP: "::1", Port: 4000}, true, "[::1]:4000"},
+		{"prefix", config.RawSocketAddress{IP: "10.0.0.7/24", Ports: "*"}, true, "10.0.0.0/24:*"},
+		{"range", config.RawSocketAddress{IP: "1.2.3.4", Ports: "4000-4100"}, true, "1.2.3.4:4000-4100"},
+		{"host", config.RawSocketAddress{Host: "origin.example.com", Port: 4000}, true, "origin.example.com:4000"},
+		{"ipAndHost", config.RawSocketAddress{IP: "1.2.3.4", Host: "origin.example.com"}, false, ""},
+		{"badIP", config.RawSocketAddress{IP: "1.2.3"}, false, ""},
+		{"badPrefix", config.RawSocketAddress{IP: "1.2.3.4/33"}, false, ""},
+		{"badHost", config.RawSocketAddress{Host: "origin.example.com:4000"}, false, ""},
+		{"reversedRange", config.RawSocketAddress{IP: "1.2.3.4", Ports: "4100-4000"}, false, ""},
+		{"badRange", config.RawSocketAddress{IP: "1.2.3.4", Ports: "4000"}, false, ""},
+		{"rangeOverflow", config.RawSocketAddress{IP: "1.2.3.4", Ports: "4000-70000"}, false, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr, err := ParseReliableSource(c.raw)
+			if (err == nil) != c.ok {
+				t.Fatalf("ParseReliableSource(%+v) error = %v, want ok %v", c.raw, err, c.ok)
+			}
+			if !c.ok {
+				return
+			}
+			if s := addr.String(); s != c.string {
+				t.Errorf("String() = %q, want %q", s, c.string)
+			}
+
+			reparsed, err := ParseReliableSource(addr.Raw())
+			if err != nil || !reparsed.Equal(&addr) {
+				t.Errorf("Raw() = %+v doesn't parse back to the same source", addr.Raw())
+			}
+		})
+	}
+}
+
+func TestReliableSourceMatch(t *testing.T) {
+	subnet, _ := ParseReliableSource(config.RawSocketAddress{IP: "10.0.0.0/24", Ports: "*"})
+	ranged, _ := ParseReliableSource(config.RawSocketAddress{IP: "10.0.0.5", Ports: "4000-4100"})
+	exact, _ := ParseReliableSource(config.RawSocketAddress{IP: "10.0.0.5", Port: 4000})
+	host, _ := ParseReliableSource(config.RawSocketAddress{Host: "origin.example.com", Port: 4000})
+	host.SetResolved([]netip.Addr{netip.MustParseAddr("10.0.1.1")})
+
+	var cases = []struct {
+		name   string
+		addr   *ReliableSource
+		ip     string
+		port   uint16
+		expect bool
+	}{
+		{"subnet", &subnet, "10.0.0.200", 1, true},
+		{"subnetMapped", &subnet, "::ffff:10.0.0.200", 1, true},
+		{"outsideSubnet", &subnet, "10.0.1.1", 1, false},
+		{"rangeLow", &ranged, "10.0.0.5", 4000, true},
+		{"rangeHigh", &ranged, "10.0.0.5", 4100, true},
+		{"outsideRange", &ranged, "10.0.0.5", 4101, false},
+		{"exact", &exact, "10.0.0.5", 4000, true},
+		{"wrongPort", &exact, "10.0.0.5", 4001, false},
+		{"resolved", &host, "10.0.1.1", 4000, true},
+		{"unresolved", &host, "10.0.1.2", 4000, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if match := c.addr.Match(netip.MustParseAddr(c.ip), c.port); match != c.expect {
+				t.Errorf("Match(%v, %v) = %v, want %v", c.ip, c.port, match, c.expect)
+			}
+		})
+	}
+
+	if !exact.MoreSpecific(&ranged) || !ranged.MoreSpecific(&subnet) || subnet.MoreSpecific(&exact) {
+		t.Error("MoreSpecific() doesn't order exact < ranged < subnet")
+	}
+	if !host.MoreSpecific(&subnet) {
+		t.Error("hostname less specific than a subnet")
+	}
+}
+
+func TestLoadTrustedSourcesInvalid(t *testing.T) {
+	originalSources, originalPath := config.Config.DB.TrustedSources, config.Config.Path.Sources
+	defer func() {
+		config.Config.DB.TrustedSources = originalSources
+		config.Config.Path.Sources = originalPath
+	}()
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "10.0.0.0/24", Ports: "*"}},
+		{RawSocketAddress: config.RawSocketAddress{IP: "10.0.0.300", Port: 4000}},
+	}
+
+	if _, err := LoadTrustedSources(); err == nil {
+		t.Error("LoadTrustedSources() accepted an invalid source")
+	}
+}
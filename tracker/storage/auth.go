@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	KeyTypeHMAC    = "hmac"    // shared secret, signature is HMAC-SHA256
+	KeyTypeEd25519 = "ed25519" // public key, signature is ed25519
+
+	signedMessageSize   = 20 + 20 + 2 + 1 + 8 + 8 + 8 + 1 + 4 + 2 + 8
+	leechersMessageSize = 8 + 20 + 20 + 2 + 8
+)
+
+var (
+	leechersMessagePrefix = []byte("leechers")
+
+	ErrUntrustedProvider = errors.New("untrusted baseline provider")
+	ErrUnknownProvider   = errors.New("not a baseline provider of the torrent")
+)
+
+// SourceKey holds the key a trusted source authenticates with.
+type SourceKey struct {
+	Type string
+	Data []byte
+}
+
+// ParseSourceKey parses a key of the form "<type>:<hex data>", ex: "hmac:00ff...".
+func ParseSourceKey(raw string) (SourceKey, error) {
+	keyType, keyHex, ok := strings.Cut(raw, ":")
+	if !ok {
+		return SourceKey{}, errors.New("key missing type prefix")
+	}
+
+	data, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return SourceKey{}, errors.Wrap(err, "failed to decode key hex")
+	}
+
+	switch keyType {
+	case KeyTypeHMAC:
+		if len(data) == 0 {
+			return SourceKey{}, errors.New("empty hmac key")
+		}
+	case KeyTypeEd25519:
+		if len(data) != ed25519.PublicKeySize {
+			return SourceKey{}, errors.Errorf("ed25519 public key must be %d bytes", ed25519.PublicKeySize)
+		}
+	default:
+		return SourceKey{}, errors.New("invalid key type '" + keyType + "'")
+	}
+
+	return SourceKey{Type: keyType, Data: data}, nil
+}
+
+// String encodes the key in the form accepted by ParseSourceKey.
+func (key SourceKey) String() string {
+	return key.Type + ":" + hex.EncodeToString(key.Data)
+}
+
+// Verify returns true if signature is a valid signature of message under the key.
+func (key SourceKey) Verify(message, signature []byte) bool {
+	switch key.Type {
+	case KeyTypeHMAC:
+		mac := hmac.New(sha256.New, key.Data)
+		mac.Write(message)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case KeyTypeEd25519:
+		return len(signature) == ed25519.SignatureSize && ed25519.Verify(ed25519.PublicKey(key.Data), message, signature)
+	}
+
+	return false
+}
+
+// Announce events numbered as in BEP 15, baseline providers sign the event they announce.
+const (
+	EventNone uint8 = iota
+	EventCompleted
+	EventStarted
+	EventStopped
+)
+
+// SignedMessage builds the message a baseline provider signs when announcing.
+// All integers are big endian:
+// hash (20) | peer id (20) | port (2) | complete (1) | uploaded (8) | downloaded (8) | left (8) | event (1) | numbaseline (4) | capacity (2) | timestamp (8)
+func SignedMessage(hash Hash, id PeerID, port uint16, complete bool, uploaded, downloaded, left int64, event uint8, numbaseline uint32, capacity uint16, timestamp int64) []byte {
+	message := make([]byte, signedMessageSize)
+
+	copy(message[0:20], hash[:])
+	copy(message[20:40], id[:])
+	binary.BigEndian.PutUint16(message[40:42], port)
+	if complete {
+		message[42] = 1
+	}
+	binary.BigEndian.PutUint64(message[43:51], uint64(uploaded))
+	binary.BigEndian.PutUint64(message[51:59], uint64(downloaded))
+	binary.BigEndian.PutUint64(message[59:67], uint64(left))
+	message[67] = event
+	binary.BigEndian.PutUint32(message[68:72], numbaseline)
+	binary.BigEndian.PutUint16(message[72:74], capacity)
+	binary.BigEndian.PutUint64(message[74:82], uint64(timestamp))
+
+	return message
+}
+
+// LeechersMessage builds the message a baseline provider signs when requesting its authorised leechers.
+// All integers are big endian: "leechers" (8) | hash (20) | peer id (20) | port (2) | timestamp (8)
+func LeechersMessage(hash Hash, id PeerID, port uint16, timestamp int64) []byte {
+	message := make([]byte, leechersMessageSize)
+
+	copy(message[0:8], leechersMessagePrefix)
+	copy(message[8:28], hash[:])
+	copy(message[28:48], id[:])
+	binary.BigEndian.PutUint16(message[48:50], port)
+	binary.BigEndian.PutUint64(message[50:58], uint64(timestamp))
+
+	return message
+}
+
+// ParseTrustedSource converts a trusted source from the configuration.
+func ParseTrustedSource(raw config.TrustedSource) (*TrustedSource, error) {
+	source := &TrustedSource{
+		Name: raw.Name,
+	}
+
+	addr, err := ParseReliableSource(raw.RawSocketAddress)
+	if err != nil {
+		return nil, err
+	}
+	source.Addr = addr
+
+	if raw.Key != "" {
+		key, err := ParseSourceKey(raw.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse trusted source key")
+		}
+		source.Key = &key
+	} else if !source.Addr.IsValid() {
+		return nil, errors.New("trusted source needs either a key, an ip or a host")
+	}
+
+	hashes := make([]Hash, len(raw.Hashes))
+	for i, rawHash := range raw.Hashes {
+		hash, err := ParseHash(rawHash)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse trusted source hash")
+		}
+		hashes[i] = hash
+	}
+	if err := source.SetScope(hashes, raw.Groups); err != nil {
+		return nil, errors.Wrap(err, "failed to scope trusted source")
+	}
+
+	if source.Name == "" {
+		if !source.Addr.IsValid() {
+			return nil, errors.New("trusted source with a key needs a name")
+		}
+		source.Name = source.Addr.String()
+	}
+
+	return source, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseSourceKey(t *testing.T) {
+	var cases = []struct {
+		name string
+		raw  string
+		ok   bool
+	}{
+		{"hmac", "hmac:736563726574", true},
+		{"ed25519", "ed25519:" + hex.EncodeToString(make([]byte, ed25519.PublicKeySize)), true},
+		{"noPrefix", "736563726574", false},
+		{"badHex", "hmac:zz", false},
+		{"emptyHmac", "hmac:", false},
+		{"shortEd25519", "ed25519:00ff", false},
+		{"badType", "rsa:00ff", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ParseSourceKey(c.raw); (err == nil) != c.ok {
+				t.Errorf("ParseSourceKey(%q) error = %v, want ok %v", c.raw, err, c.ok)
+			}
+		})
+	}
+}
+
+func TestSourceKeyVerify(t *testing.T) {
+	message := SignedMessage(Hash{1}, PeerID{2}, 4000, true, 10, 20, 0, EventCompleted, 2, 8, 1234567890)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(message)
+	hmacKey := SourceKey{Type: KeyTypeHMAC, Data: []byte("secret")}
+	if !hmacKey.Verify(message, mac.Sum(nil)) {
+		t.Error("valid hmac signature rejected")
+	}
+	if hmacKey.Verify(message[1:], mac.Sum(nil)) {
+		t.Error("hmac signature accepted for a different message")
+	}
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey := SourceKey{Type: KeyTypeEd25519, Data: public}
+	if !edKey.Verify(message, ed25519.Sign(private, message)) {
+		t.Error("valid ed25519 signature rejected")
+	}
+	if edKey.Verify(message, []byte("short")) {
+		t.Error("malformed ed25519 signature accepted")
+	}
+}
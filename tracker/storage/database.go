@@ -6,6 +6,7 @@ package storage
 
 import (
 	"net/netip"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -45,16 +46,28 @@ type Database interface {
 	Trim()
 	SyncExpvars() error
 
-	Save(netip.Addr, uint16, bool, Hash, PeerID, int64, int64, bool) bool
-	Drop(Hash, PeerID, bool)
+	Save(netip.Addr, netip.Addr, uint16, bool, bool, Hash, PeerID, int64, int64, int64, *ProviderClaim) bool
+	Drop(Hash, PeerID, netip.AddrPort)
 
-	HashStats(Hash) (uint16, uint16)
-	BaselineProvider(Hash, bool, bool) ([]byte, error)
-	PeerList(Hash, uint, bool) [][]byte
-	PeerListBytes(Hash, uint) ([]byte, []byte)
+	HashStats(Hash) (uint16, uint16, uint32)
+	Rates(Hash) (Rates, []PeerRates)
+	Penalty(netip.Addr) Penalty
+	HandoutBaseline(Hash, PeerID, Penalty) bool
+	BaselineProviders(Hash, PeerID, uint, bool, bool) [][]byte
+	AuthorizedLeechers(netip.Addr, uint16, Hash, PeerID, *ProviderClaim) ([]Leecher, error)
+	Report(netip.Addr, *Report, *ProviderClaim) error
+	PeerList(Hash, Requester, uint, bool) [][]byte
+	PeerListBytes(Hash, Requester, uint) ([]byte, []byte)
 
 	// Number of hashes for stats
 	Hashes() int
+
+	// Runtime management of trusted sources
+	TrustedSources() []TrustedSource
+	AddTrustedSource(*TrustedSource) error
+	RemoveTrustedSource(string) error
+	SuspendTrustedSource(string, time.Time) error
+	ScopeTrustedSource(string, []Hash, []string) error
 }
 
 type Backup interface {
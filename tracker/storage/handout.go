@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+// HandoutState holds what a handout rule is decided on.
+type HandoutState struct {
+	Seeders  uint16 // complete peers in the swarm
+	Age      int64  // seconds since the swarm was created
+	Stalled  uint16 // announces the left of the peer hasn't decreased for
+	Offences uint   // unforgiven bad actor offences of the address
+}
+
+// Handout returns true if the rule allows handing baseline providers to a peer in the state.
+func Handout(rule config.HandoutRule, state HandoutState) bool {
+	if rule.NoBadActors && state.Offences > 0 {
+		return false
+	}
+	if rule.Bootstrap > 0 && state.Age < int64(rule.Bootstrap.Seconds()) {
+		return true
+	}
+	if rule.MaxSeeders > 0 && state.Seeders >= rule.MaxSeeders {
+		return false
+	}
+	if rule.Stalled > 0 && state.Stalled < rule.Stalled {
+		return false
+	}
+
+	return true
+}
+
+// HandoutRules holds the global handout rule and the rules of torrents that replace it.
+type HandoutRules struct {
+	global   config.HandoutRule
+	torrents map[Hash]config.HandoutRule
+}
+
+// ParseHandoutRules resolves the torrent rules keyed by hex infohash or hash group.
+// Infohash keys take precedence over groups, hashes in several groups get the rule of the first group by name.
+func ParseHandoutRules(global config.HandoutRule, torrents map[string]config.HandoutRule) (*HandoutRules, error) {
+	rules := &HandoutRules{
+		global:   global,
+		torrents: make(map[Hash]config.HandoutRule),
+	}
+
+	groups := make([]string, 0, len(torrents))
+	for key := range torrents {
+		if _, err := ParseHash(key); err != nil {
+			groups = append(groups, key)
+		}
+	}
+	sort.Strings(groups)
+
+	for _, key := range groups {
+		rawHashes, ok := config.Config.DB.HashGroups[key]
+		if !ok {
+			return nil, errors.New("'" + key + "' is neither an infohash nor a hash group")
+		}
+		for _, raw := range rawHashes {
+			hash, err := ParseHash(raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid infohash in hash group '"+key+"'")
+			}
+			if _, ok := rules.torrents[hash]; !ok {
+				rules.torrents[hash] = torrents[key]
+			}
+		}
+	}
+	for key, rule := range torrents {
+		if hash, err := ParseHash(key); err == nil {
+			rules.torrents[hash] = rule
+		}
+	}
+
+	return rules, nil
+}
+
+// Rule returns the handout rule of the hash, a nil HandoutRules always hands out.
+func (rules *HandoutRules) Rule(hash Hash) config.HandoutRule {
+	if rules == nil {
+		return config.HandoutRule{}
+	}
+	if rule, ok := rules.torrents[hash]; ok {
+		return rule
+	}
+	return rules.global
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestHandout(t *testing.T) {
+	var cases = []struct {
+		name    string
+		rule    config.HandoutRule
+		state   HandoutState
+		handout bool
+	}{
+		{"noRules", config.HandoutRule{}, HandoutState{Seeders: 100, Offences: 3}, true},
+		{"fewSeeders", config.HandoutRule{MaxSeeders: 5}, HandoutState{Seeders: 4}, true},
+		{"enoughSeeders", config.HandoutRule{MaxSeeders: 5}, HandoutState{Seeders: 5}, false},
+		{"stalled", config.HandoutRule{Stalled: 3}, HandoutState{Stalled: 3}, true},
+		{"progressing", config.HandoutRule{Stalled: 3}, HandoutState{Stalled: 2}, false},
+		{"bootstrap", config.HandoutRule{MaxSeeders: 5, Stalled: 3, Bootstrap: time.Hour}, HandoutState{Seeders: 10, Age: 60}, true},
+		{"bootstrapped", config.HandoutRule{MaxSeeders: 5, Bootstrap: time.Hour}, HandoutState{Seeders: 10, Age: 3600}, false},
+		{"badActor", config.HandoutRule{NoBadActors: true, Bootstrap: time.Hour}, HandoutState{Offences: 1}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if handout := Handout(c.rule, c.state); handout != c.handout {
+				t.Errorf("Handout(%+v, %+v) = %v, want %v", c.rule, c.state, handout, c.handout)
+			}
+		})
+	}
+}
+
+func TestParseHandoutRules(t *testing.T) {
+	hash := Hash{1}
+	grouped := Hash{2}
+	config.Config.DB.HashGroups = map[string][]string{
+		"releases": {"0100000000000000000000000000000000000000", "0200000000000000000000000000000000000000"},
+	}
+	defer func() { config.Config.DB.HashGroups = nil }()
+
+	global := config.HandoutRule{MaxSeeders: 1}
+	rules, err := ParseHandoutRules(global, map[string]config.HandoutRule{
+		"releases": {MaxSeeders: 2},
+		"0100000000000000000000000000000000000000": {MaxSeeders: 3},
+	})
+	if err != nil {
+		t.Fatal("ParseHandoutRules() threw error:", err)
+	}
+
+	if rule := rules.Rule(hash); rule.MaxSeeders != 3 {
+		t.Errorf("infohash rule = %+v, want MaxSeeders 3", rule)
+	}
+	if rule := rules.Rule(grouped); rule.MaxSeeders != 2 {
+		t.Errorf("group rule = %+v, want MaxSeeders 2", rule)
+	}
+	if rule := rules.Rule(Hash{3}); rule != global {
+		t.Errorf("other rule = %+v, want global", rule)
+	}
+	if rule := (*HandoutRules)(nil).Rule(hash); rule != (config.HandoutRule{}) {
+		t.Errorf("nil rule = %+v, want none", rule)
+	}
+
+	if _, err := ParseHandoutRules(global, map[string]config.HandoutRule{"missing": {}}); err == nil {
+		t.Error("ParseHandoutRules() accepted an unknown hash group")
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Locality maps address prefixes to the network they belong to, an ASN or a region.
+type Locality struct {
+	networks map[netip.Prefix]string
+	bits     []int // prefix lengths present in networks, longest first
+}
+
+// LoadLocality loads the locality data file at path, nil if path is empty.
+func LoadLocality(path string) (*Locality, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open locality file")
+	}
+	defer file.Close()
+
+	return ParseLocality(file)
+}
+
+// ParseLocality parses locality data, one "<prefix> <network>" pair per line.
+// Blank lines and lines starting with # are skipped.
+func ParseLocality(reader io.Reader) (*Locality, error) {
+	locality := &Locality{networks: make(map[netip.Prefix]string)}
+	lengths := make(map[int]struct{})
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: want a prefix and a network", line)
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d: invalid prefix", line)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+
+		locality.networks[prefix] = fields[1]
+		lengths[prefix.Bits()] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read locality data")
+	}
+
+	for bits := range lengths {
+		locality.bits = append(locality.bits, bits)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(locality.bits)))
+
+	return locality, nil
+}
+
+// Network returns the network of the longest prefix containing the address, empty if there is none.
+func (locality *Locality) Network(ip netip.Addr) string {
+	if locality == nil {
+		return ""
+	}
+
+	ip = ip.Unmap()
+	for _, bits := range locality.bits {
+		if bits > ip.BitLen() {
+			continue
+		}
+		prefix, _ := ip.Prefix(bits)
+		if network, ok := locality.networks[prefix]; ok {
+			return network
+		}
+	}
+	return ""
+}
+
+// SameSubnet returns true if both addresses are in the same /24 for IPv4 or /48 for IPv6.
+func SameSubnet(a, b netip.Addr) bool {
+	a, b = a.Unmap(), b.Unmap()
+	if a.Is4() != b.Is4() {
+		return false
+	}
+
+	bits := 48
+	if a.Is4() {
+		bits = 24
+	}
+	pa, _ := a.Prefix(bits)
+	pb, _ := b.Prefix(bits)
+	return pa == pb
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestLocality(t *testing.T) {
+	locality, err := ParseLocality(strings.NewReader(`
+# prefix network
+10.0.0.0/8      AS64500
+10.1.0.0/16     AS64501
+2001:db8::/32   eu-west
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip      string
+		network string
+	}{
+		{"10.2.3.4", "AS64500"},
+		{"10.1.3.4", "AS64501"},
+		{"::ffff:10.1.3.4", "AS64501"},
+		{"2001:db8:1::1", "eu-west"},
+		{"192.168.0.1", ""},
+	}
+	for _, c := range cases {
+		if network := locality.Network(netip.MustParseAddr(c.ip)); network != c.network {
+			t.Errorf("Network(%v) = %q, want %q", c.ip, network, c.network)
+		}
+	}
+
+	if network := (*Locality)(nil).Network(netip.MustParseAddr("10.0.0.1")); network != "" {
+		t.Errorf("nil Network() = %q, want none", network)
+	}
+	for _, data := range []string{"10.0.0.0/8", "10.0.0.0/33 AS1", "10.0.0.0/8 AS1 extra"} {
+		if _, err := ParseLocality(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseLocality(%q) succeeded", data)
+		}
+	}
+}
+
+func TestSameSubnet(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{"10.0.0.1", "10.0.0.200", true},
+		{"10.0.0.1", "10.0.1.1", false},
+		{"::ffff:10.0.0.1", "10.0.0.2", true},
+		{"2001:db8:1::1", "2001:db8:1:ff::1", true},
+		{"2001:db8:1::1", "2001:db8:2::1", false},
+		{"10.0.0.1", "::a00:1", false},
+	}
+	for _, c := range cases {
+		if same := SameSubnet(netip.MustParseAddr(c.a), netip.MustParseAddr(c.b)); same != c.same {
+			t.Errorf("SameSubnet(%v, %v) = %v, want %v", c.a, c.b, same, c.same)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gomap
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// authenticate returns the trusted source the baseline provider claim comes from or nil if it can't be trusted.
+// Sources with a key must provide a fresh signature over the message, keyless sources must send it from their address.
+func (db *Memory) authenticate(ip netip.Addr, port uint16, claim *storage.ProviderClaim, message []byte) *storage.TrustedSource {
+	db.mutex.RLock()
+	var source *storage.TrustedSource
+	if claim.Source != "" {
+		source = db.trustedSources[claim.Source]
+	} else {
+		source = db.keylessSource(ip, port)
+	}
+	var suspended, matched bool
+	now := time.Now().Unix()
+	if source != nil {
+		suspended = source.Suspended(now)
+		matched = source.Key == nil && source.Addr.Match(ip, port) // resolved hostnames are guarded by the lock
+	}
+	db.mutex.RUnlock()
+
+	if source == nil {
+		stats.ProviderAuthFailures.Add(1)
+		return nil
+	}
+	if suspended {
+		return nil
+	}
+
+	if source.Key == nil {
+		if !matched {
+			stats.ProviderAuthFailures.Add(1)
+			return nil
+		}
+		return source
+	}
+
+	window := int64(config.Config.DB.SignatureWindow.Seconds())
+	if claim.Timestamp < now-window || claim.Timestamp > now+window {
+		stats.ProviderReplays.Add(1)
+		return nil
+	}
+
+	if !source.Key.Verify(message, claim.Signature) {
+		stats.ProviderAuthFailures.Add(1)
+		return nil
+	}
+
+	// a valid signature can only be used once
+	db.signatureMutex.Lock()
+	if _, seen := db.signatures[string(claim.Signature)]; seen {
+		db.signatureMutex.Unlock()
+		stats.ProviderReplays.Add(1)
+		return nil
+	}
+	db.signatures[string(claim.Signature)] = claim.Timestamp
+	db.signatureMutex.Unlock()
+
+	return source
+}
+
+// trimSignatures forgets signatures that have fallen out of the signature window, they can no longer be replayed.
+func (db *Memory) trimSignatures() (signatures int) {
+	oldest := time.Now().Unix() - int64(config.Config.DB.SignatureWindow.Seconds())
+
+	db.signatureMutex.Lock()
+	for signature, timestamp := range db.signatures {
+		if timestamp < oldest {
+			delete(db.signatures, signature)
+			signatures++
+		}
+	}
+	db.signatureMutex.Unlock()
+
+	return
+}
@@ -0,0 +1,144 @@
+package gomap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func signClaim(key []byte, source string, timestamp int64, hash storage.Hash, id storage.PeerID, port uint16) *storage.ProviderClaim {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(storage.SignedMessage(hash, id, port, true, 0, 0, 0, storage.EventNone, 0, 0, timestamp))
+
+	return &storage.ProviderClaim{
+		Source:    source,
+		Timestamp: timestamp,
+		Signature: mac.Sum(nil),
+	}
+}
+
+func TestSaveBaselineProviderSigned(t *testing.T) {
+	key := []byte("secret")
+	config.Config.DB.SignatureWindow = 30 * time.Second
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{Name: "origin", Key: "hmac:736563726574"},
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	now := time.Now().Unix()
+	raised := signClaim(key, "origin", now+4, testHash, testId, 1111)
+	raised.Capacity = 16 // not what was signed
+	started := signClaim(key, "origin", now+5, testHash, testId, 1111)
+	started.Event = storage.EventStarted
+	more := signClaim(key, "origin", now+6, testHash, testId, 1111)
+	more.NumBaseline = 8
+	cases := []struct {
+		name     string
+		port     uint16
+		claim    *storage.ProviderClaim
+		accepted bool
+		authErrs int64
+		replays  int64
+	}{
+		{"signed", 1111, signClaim(key, "origin", now, testHash, testId, 1111), true, 0, 0},
+		{"replayed", 1111, signClaim(key, "origin", now, testHash, testId, 1111), false, 0, 1},
+		{"stale", 1111, signClaim(key, "origin", now-60, testHash, testId, 1111), false, 0, 1},
+		{"wrongKey", 1111, signClaim([]byte("wrong"), "origin", now+1, testHash, testId, 1111), false, 1, 0},
+		{"tampered", 2222, signClaim(key, "origin", now+2, testHash, testId, 1111), false, 1, 0},
+		{"unknownSource", 1111, signClaim(key, "unknown", now+3, testHash, testId, 1111), false, 1, 0},
+		{"tamperedCapacity", 1111, raised, false, 1, 0},
+		{"tamperedEvent", 1111, started, false, 1, 0},
+		{"tamperedNumBaseline", 1111, more, false, 1, 0},
+		{"address", 4000, &storage.ProviderClaim{}, true, 0, 0},
+		{"wrongAddress", 4001, &storage.ProviderClaim{}, false, 1, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			authErrs := stats.ProviderAuthFailures.Load()
+			replays := stats.ProviderReplays.Load()
+
+			if accepted := db.Save(testIP, netip.Addr{}, c.port, true, false, testHash, testId, 0, 0, 0, c.claim); accepted != c.accepted {
+				t.Errorf("Save() = %v, want %v", accepted, c.accepted)
+			}
+			if delta := stats.ProviderAuthFailures.Load() - authErrs; delta != c.authErrs {
+				t.Errorf("auth failures += %v, want %v", delta, c.authErrs)
+			}
+			if delta := stats.ProviderReplays.Load() - replays; delta != c.replays {
+				t.Errorf("replays += %v, want %v", delta, c.replays)
+			}
+		})
+	}
+
+	// left isn't part of the claim but is signed all the same
+	if db.Save(testIP, netip.Addr{}, 1111, true, false, testHash, testId, 0, 0, 100, signClaim(key, "origin", now+7, testHash, testId, 1111)) {
+		t.Error("Save() accepted a claim with a tampered left")
+	}
+
+	if db.trimSignatures() != 0 {
+		t.Error("trimSignatures() removed signatures within the window")
+	}
+}
+
+func TestAuthenticateKeylessMatch(t *testing.T) {
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "10.0.0.0/24", Ports: "*"}, Name: "subnet"},
+		{RawSocketAddress: config.RawSocketAddress{IP: "10.0.0.5", Ports: "4000-4100"}, Name: "ranged"},
+		{RawSocketAddress: config.RawSocketAddress{Host: "localhost", Port: 4000}, Name: "host"},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
+	var db Memory
+	db.make()
+	db.resolveSources()
+
+	cases := []struct {
+		name   string
+		ip     string
+		port   uint16
+		source string
+	}{
+		{"subnet", "10.0.0.9", 6881, "subnet"},
+		{"mostSpecific", "10.0.0.5", 4050, "ranged"},
+		{"outsideRange", "10.0.0.5", 4101, "subnet"},
+		{"hostname", "127.0.0.1", 4000, "host"},
+		{"hostnameWrongPort", "127.0.0.1", 4001, ""},
+		{"unknown", "10.0.1.1", 4000, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var name string
+			if source := db.authenticate(netip.MustParseAddr(c.ip), c.port, &storage.ProviderClaim{}, nil); source != nil {
+				name = source.Name
+			}
+			if name != c.source {
+				t.Errorf("authenticate() = %q, want %q", name, c.source)
+			}
+		})
+	}
+
+	if err := db.AddTrustedSource(&storage.TrustedSource{Name: "copy", Addr: db.trustedSources["ranged"].Addr}); err == nil {
+		t.Error("AddTrustedSource() accepted a duplicate address")
+	}
+	if err := db.RemoveTrustedSource("ranged"); err != nil {
+		t.Fatal(err)
+	}
+	if source := db.authenticate(netip.MustParseAddr("10.0.0.5"), 4050, &storage.ProviderClaim{}, nil); source == nil || source.Name != "subnet" {
+		t.Error("removed source still matched")
+	}
+}
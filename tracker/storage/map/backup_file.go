@@ -39,24 +39,24 @@ func (bck *FileBackup) Load() error {
 		return errors.Wrap(err, "failed to stat file")
 	}
 
-	peers, hashes, err := bck.db.loadFile(config.Config.DB.Backup.Path)
+	peers, providers, hashes, err := bck.db.loadFile(config.Config.DB.Backup.Path)
 	if err != nil {
 		return errors.Wrap(err, "failed to load file")
 	}
 
-	config.Logger.Info("Loaded database", zap.Duration("time", time.Since(start)), zap.Int("peers", peers), zap.Int("hashes", hashes))
+	config.Logger.Info("Loaded database", zap.Duration("time", time.Since(start)), zap.Int("peers", peers), zap.Int("baselineProviders", providers), zap.Int("hashes", hashes))
 
 	return nil
 }
 
-func (db *Memory) loadFile(filename string) (peers int, hashes int, err error) {
+func (db *Memory) loadFile(filename string) (peers int, providers int, hashes int, err error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		err = errors.Wrap(err, "failed to read file from disk")
 		return
 	}
 
-	peers, hashes, err = db.decodeBinary(data)
+	peers, providers, hashes, err = db.decodeBinary(data)
 	err = errors.Wrap(err, "failed to decode saved data")
 
 	return
@@ -118,12 +118,12 @@ attemptLoad:
 		goto attemptLoad
 	}
 
-	peers, hashes, err := bck.db.decodeBinary(bytes)
+	peers, providers, hashes, err := bck.db.decodeBinary(bytes)
 	if err != nil {
 		return errors.Wrap(err, "failed to decode data")
 	}
 
-	config.Logger.Info("Loaded stored database from pg", zap.Int("size", len(bytes)), zap.Any("hash", bytes[:20]), zap.Int("peers", peers), zap.Int("hashes", hashes))
+	config.Logger.Info("Loaded stored database from pg", zap.Int("size", len(bytes)), zap.Any("hash", bytes[:20]), zap.Int("peers", peers), zap.Int("baselineProviders", providers), zap.Int("hashes", hashes))
 
 	return nil
 }
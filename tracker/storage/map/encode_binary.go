@@ -8,65 +8,432 @@ import (
 	"io"
 	"net/netip"
 
-	"github.com/crimist/trakx/pools"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
+// binaryMagic prefixes versioned binary backups, backups without it are in the original peers only format
+var binaryMagic = [6]byte{'T', 'R', 'A', 'K', 'X', 0}
+
+// binaryVersion is the version written by encodeBinary
+const binaryVersion uint8 = 1
+
+// swarmRecord is the fixed size binary backup record of a swarm, it is followed by its peers and baseline providers
+type swarmRecord struct {
+	Hash      storage.Hash
+	Peers     uint32
+	Providers uint32
+	Snatches  uint32
+	Created   int64
+}
+
+// peerRecord is the fixed size binary backup record of a peer
+type peerRecord struct {
+	ID               storage.PeerID
+	Complete         bool
+	AddrLen          uint8
+	Addr             [16]byte
+	AltAddrLen       uint8
+	AltAddr          [16]byte
+	Port             uint16
+	LastSeen         int64
+	Uploaded         int64
+	Downloaded       int64
+	LeechersLastTime uint16
+	Left             int64
+	Stalled          uint16
+	UploadRate       int64
+	DownloadRate     int64
+	WindowStart      int64
+	WindowUploaded   int64
+	WindowDownloaded int64
+}
+
+// providerRecord is the binary backup record of a baseline provider.
+// It is followed by SourceLen bytes of source name and Referred referralRecords.
+type providerRecord struct {
+	Peer          peerRecord
+	Capacity      uint16
+	SourceLen     uint16
+	Referrals     uint32
+	PrevReferrals uint32
+	WindowStart   int64
+	Referred      uint32
+}
+
+// referralRecord is the binary backup record of a peer referred to a baseline provider
+type referralRecord struct {
+	ID storage.PeerID
+	At int64
+}
+
+// offenderRecord is the fixed size binary backup record of an address detected as a bad actor
+type offenderRecord struct {
+	AddrLen     uint8
+	Addr        [16]byte
+	Offences    uint32
+	LastOffence int64
+	BannedUntil int64
+}
+
+// reputationRecord is the fixed size binary backup record of the reputation of an address
+type reputationRecord struct {
+	AddrLen uint8
+	Addr    [16]byte
+	Score   float64
+	Updated int64
+}
+
+func newPeerRecord(id storage.PeerID, peer *storage.Peer) (record peerRecord) {
+	record.ID = id
+	record.Complete = peer.Complete
+	record.AddrLen = uint8(copy(record.Addr[:], peer.IP.AsSlice()))
+	record.Port = peer.Port
+	record.LastSeen = peer.LastSeen
+	record.Uploaded = peer.Uploaded
+	record.Downloaded = peer.Downloaded
+	record.LeechersLastTime = peer.LeechersLastTime
+	record.AltAddrLen = uint8(copy(record.AltAddr[:], peer.AltIP.AsSlice()))
+	record.Left = peer.Left
+	record.Stalled = peer.Stalled
+	record.UploadRate = peer.UploadRate
+	record.DownloadRate = peer.DownloadRate
+	record.WindowStart = peer.WindowStart
+	record.WindowUploaded = peer.WindowUploaded
+	record.WindowDownloaded = peer.WindowDownloaded
+	return
+}
+
+func (record *peerRecord) peer(peer *storage.Peer) error {
+	ip, ok := netip.AddrFromSlice(record.Addr[:record.AddrLen])
+	if !ok {
+		return errors.New("AddrFromSlice failed")
+	}
+
+	peer.Complete = record.Complete
+	peer.IP = ip
+	peer.Port = record.Port
+	peer.LastSeen = record.LastSeen
+	peer.Uploaded = record.Uploaded
+	peer.Downloaded = record.Downloaded
+	peer.LeechersLastTime = record.LeechersLastTime
+	peer.AltIP = netip.Addr{}
+	if record.AltAddrLen > 0 {
+		if peer.AltIP, ok = netip.AddrFromSlice(record.AltAddr[:record.AltAddrLen]); !ok {
+			return errors.New("AddrFromSlice failed")
+		}
+	}
+	peer.UploadRate = record.UploadRate
+	peer.DownloadRate = record.DownloadRate
+	peer.Left = record.Left
+	peer.Stalled = record.Stalled
+	peer.WindowStart = record.WindowStart
+	peer.WindowUploaded = record.WindowUploaded
+	peer.WindowDownloaded = record.WindowDownloaded
+	return nil
+}
+
+// encodeBinary encodes the database in the versioned binary format:
+//
+//	magic (6) | version (1) | reputations (4) | reputationRecord * reputations | offenders (4) | offenderRecord * offenders |
+//	{ swarmRecord | peerRecord * peers | (providerRecord | source | referralRecord * referred) * providers } * hashes
 func (db *Memory) encodeBinary() ([]byte, error) {
 	var buff bytes.Buffer
 	writer := bufio.NewWriter(&buff)
 
-	db.mutex.RLock()
-	for hash, submap := range db.hashmap {
-		db.mutex.RUnlock()
+	if err := binary.Write(writer, binary.LittleEndian, binaryMagic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(writer, binary.LittleEndian, binaryVersion); err != nil {
+		return nil, err
+	}
+
+	db.reputationMutex.RLock()
+	err := db.encodeReputations(writer)
+	db.reputationMutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
 
-		// write hash and peermap size
-		if err := binary.Write(writer, binary.LittleEndian, &hash); err != nil {
+	db.offenderMutex.RLock()
+	err = db.encodeOffenders(writer)
+	db.offenderMutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range db.shards {
+		if err := db.shards[i].encode(writer); err != nil {
 			return nil, err
 		}
-		if err := binary.Write(writer, binary.LittleEndian, uint32(len(submap.Peers))); err != nil {
-			return nil, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// encodeReputations writes the reputation of every address, the caller must hold the reputation read lock
+func (db *Memory) encodeReputations(writer io.Writer) error {
+	if err := binary.Write(writer, binary.LittleEndian, uint32(len(db.reputations))); err != nil {
+		return err
+	}
+
+	for ip, r := range db.reputations {
+		record := reputationRecord{
+			Score:   r.score,
+			Updated: r.updated,
 		}
+		record.AddrLen = uint8(copy(record.Addr[:], ip.AsSlice()))
+		if err := binary.Write(writer, binary.LittleEndian, &record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeOffenders writes the record of every offender, the caller must hold the offender read lock
+func (db *Memory) encodeOffenders(writer io.Writer) error {
+	if err := binary.Write(writer, binary.LittleEndian, uint32(len(db.offenders))); err != nil {
+		return err
+	}
 
-		// write peerid and peer
+	for ip, o := range db.offenders {
+		record := offenderRecord{
+			Offences:    uint32(o.offences),
+			LastOffence: o.lastOffence,
+			BannedUntil: o.bannedUntil,
+		}
+		record.AddrLen = uint8(copy(record.Addr[:], ip.AsSlice()))
+		if err := binary.Write(writer, binary.LittleEndian, &record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encode writes the swarms of the shard
+func (s *shard) encode(writer io.Writer) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for hash, submap := range s.hashmap {
 		submap.mutex.RLock()
-		for id, peer := range submap.Peers {
-			if err := binary.Write(writer, binary.LittleEndian, &id); err != nil {
-				return nil, err
+		err := encodePeermap(writer, hash, submap)
+		submap.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodePeermap writes the swarm of a hash with its peers and baseline providers, the caller must hold the peermap read lock
+func encodePeermap(writer io.Writer, hash storage.Hash, submap *PeerMap) error {
+	swarm := swarmRecord{
+		Hash:      hash,
+		Peers:     uint32(submap.Peers.len()),
+		Providers: uint32(len(submap.BaselineProviders)),
+		Snatches:  submap.Snatches,
+		Created:   submap.Created,
+	}
+	if err := binary.Write(writer, binary.LittleEndian, &swarm); err != nil {
+		return err
+	}
+
+	var err error
+	submap.Peers.each(func(s *slot) bool {
+		peer := s.peer()
+		record := newPeerRecord(s.ID, &peer)
+		err = binary.Write(writer, binary.LittleEndian, &record)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, provider := range submap.BaselineProviders {
+		record := providerRecord{
+			Peer:          newPeerRecord(id, &provider.Peer),
+			Capacity:      provider.Capacity,
+			SourceLen:     uint16(len(provider.Source)),
+			Referrals:     provider.referrals,
+			PrevReferrals: provider.prevReferrals,
+			WindowStart:   provider.windowStart,
+			Referred:      uint32(len(provider.referred)),
+		}
+		if err := binary.Write(writer, binary.LittleEndian, &record); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(writer, provider.Source); err != nil {
+			return err
+		}
+		for id, at := range provider.referred {
+			if err := binary.Write(writer, binary.LittleEndian, referralRecord{ID: id, At: at}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeBinary decodes a binary backup in either the versioned or the original format.
+// Baseline providers whose trusted source no longer exists are skipped.
+func (db *Memory) decodeBinary(data []byte) (peers, providers, hashes int, err error) {
+	db.make()
+	defer db.index()
+
+	if !bytes.HasPrefix(data, binaryMagic[:]) {
+		peers, hashes, err = db.decodeBinaryV0(data)
+		return
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data[len(binaryMagic):]))
+	var version uint8
+	if err = binary.Read(reader, binary.LittleEndian, &version); err != nil {
+		return
+	}
+	if version != binaryVersion {
+		err = errors.New("unsupported binary backup version")
+		return
+	}
+	if err = db.decodeReputations(reader); err != nil {
+		return
+	}
+	if err = db.decodeOffenders(reader); err != nil {
+		return
+	}
+
+	for {
+		var swarm swarmRecord
+		err = binary.Read(reader, binary.LittleEndian, &swarm)
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+
+		peermap := db.shard(swarm.Hash).makePeermap(swarm.Hash)
+		peermap.Snatches = swarm.Snatches
+		peermap.Created = swarm.Created
+
+		for i := uint32(0); i < swarm.Peers; i++ {
+			var record peerRecord
+			if err = binary.Read(reader, binary.LittleEndian, &record); err != nil {
+				return
+			}
+
+			var peer storage.Peer
+			if err = record.peer(&peer); err != nil {
+				return
 			}
+			peermap.Peers.put(record.ID, &peer)
+			peers++
 
-			addrSlice := peer.IP.AsSlice()
-			if err := binary.Write(writer, binary.LittleEndian, peer.Complete); err != nil {
-				return nil, err
+			if peer.Complete {
+				peermap.Complete++
+			} else {
+				peermap.Incomplete++
 			}
-			if err := binary.Write(writer, binary.LittleEndian, int32(len(addrSlice))); err != nil {
-				return nil, err
+			peermap.Rates.Upload += peer.UploadRate
+			peermap.Rates.Download += peer.DownloadRate
+		}
+
+		for i := uint32(0); i < swarm.Providers; i++ {
+			var record providerRecord
+			if err = binary.Read(reader, binary.LittleEndian, &record); err != nil {
+				return
 			}
-			if err := binary.Write(writer, binary.LittleEndian, addrSlice); err != nil {
-				return nil, err
+			source := make([]byte, record.SourceLen)
+			if _, err = io.ReadFull(reader, source); err != nil {
+				return
+			}
+			referred := make(map[storage.PeerID]int64, record.Referred)
+			for ; record.Referred > 0; record.Referred-- {
+				var referral referralRecord
+				if err = binary.Read(reader, binary.LittleEndian, &referral); err != nil {
+					return
+				}
+				referred[referral.ID] = referral.At
 			}
-			if err := binary.Write(writer, binary.LittleEndian, peer.Port); err != nil {
-				return nil, err
+
+			if _, ok := db.trustedSources[string(source)]; !ok {
+				continue
 			}
-			if err := binary.Write(writer, binary.LittleEndian, peer.LastSeen); err != nil {
-				return nil, err
+
+			provider := &Provider{
+				Source:        string(source),
+				Capacity:      record.Capacity,
+				referrals:     record.Referrals,
+				prevReferrals: record.PrevReferrals,
+				windowStart:   record.WindowStart,
 			}
+			if len(referred) > 0 {
+				provider.referred = referred
+			}
+			if err = record.Peer.peer(&provider.Peer); err != nil {
+				return
+			}
+			peermap.BaselineProviders[record.Peer.ID] = provider
+			providers++
 		}
-		submap.mutex.RUnlock()
 
-		db.mutex.RLock()
+		hashes++
 	}
-	db.mutex.RUnlock()
 
-	if err := writer.Flush(); err != nil {
-		return nil, err
+	return
+}
+
+func (db *Memory) decodeReputations(reader io.Reader) error {
+	var count uint32
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return err
 	}
 
-	return buff.Bytes(), nil
+	for ; count > 0; count-- {
+		var record reputationRecord
+		if err := binary.Read(reader, binary.LittleEndian, &record); err != nil {
+			return err
+		}
+		ip, ok := netip.AddrFromSlice(record.Addr[:record.AddrLen])
+		if !ok {
+			return errors.New("AddrFromSlice failed")
+		}
+		db.reputations[ip] = &reputation{score: record.Score, updated: record.Updated}
+	}
+
+	return nil
 }
 
-func (db *Memory) decodeBinary(data []byte) (peers, hashes int, err error) {
-	db.make()
+func (db *Memory) decodeOffenders(reader io.Reader) error {
+	var count uint32
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return err
+	}
+
+	for ; count > 0; count-- {
+		var record offenderRecord
+		if err := binary.Read(reader, binary.LittleEndian, &record); err != nil {
+			return err
+		}
+		ip, ok := netip.AddrFromSlice(record.Addr[:record.AddrLen])
+		if !ok {
+			return errors.New("AddrFromSlice failed")
+		}
+		db.offenders[ip] = &offender{offences: uint(record.Offences), lastOffence: record.LastOffence, bannedUntil: record.BannedUntil}
+	}
+
+	return nil
+}
+
+// decodeBinaryV0 decodes the original binary format which only holds the complete, ip, port and last seen of peers
+func (db *Memory) decodeBinaryV0(data []byte) (peers, hashes int, err error) {
 	reader := bufio.NewReader(bytes.NewBuffer(data))
 
 	for {
@@ -82,7 +449,7 @@ func (db *Memory) decodeBinary(data []byte) (peers, hashes int, err error) {
 
 		var count uint32
 		var complete uint16
-		peermap := db.makePeermap(hash)
+		peermap := db.shard(hash).makePeermap(hash)
 		if err = binary.Read(reader, binary.LittleEndian, &count); err != nil {
 			return
 		}
@@ -94,7 +461,7 @@ func (db *Memory) decodeBinary(data []byte) (peers, hashes int, err error) {
 				return
 			}
 
-			peer := pools.Peers.Get()
+			peer := new(storage.Peer)
 			var addrSliceLen int32
 			if err = binary.Read(reader, binary.LittleEndian, &peer.Complete); err != nil {
 				return
@@ -118,7 +485,7 @@ func (db *Memory) decodeBinary(data []byte) (peers, hashes int, err error) {
 			if err = binary.Read(reader, binary.LittleEndian, &peer.LastSeen); err != nil {
 				return
 			}
-			peermap.Peers[id] = peer
+			peermap.Peers.put(id, peer)
 			peers++
 
 			if peer.Complete {
@@ -128,7 +495,7 @@ func (db *Memory) decodeBinary(data []byte) (peers, hashes int, err error) {
 
 		// set complete and incomplete
 		peermap.Complete = complete
-		peermap.Incomplete = uint16(len(peermap.Peers)) - complete
+		peermap.Incomplete = uint16(peermap.Peers.len()) - complete
 
 		hashes++
 	}
@@ -1,51 +1,145 @@
 package gomap
 
 import (
+	"bytes"
+	"encoding/binary"
 	"net/netip"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
 func TestEncodeDecodeBinary(t *testing.T) {
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "127.0.0.2", Port: 4000}, Name: "origin"},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
 	var db Memory
 	db.make()
 	pools.Initialize(10)
 
 	hash := storage.Hash{0x48, 0x61, 0x73, 0x68, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
 	peerid := storage.PeerID{0x49, 0x44, 0x49, 0x44, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	providerid := storage.PeerID{0x50, 0x52, 0x4f, 0x56}
 	peer := storage.Peer{
-		Complete: true,
-		IP:       netip.MustParseAddr("127.0.0.1"),
-		Port:     0x4f50,
-		LastSeen: time.Now().Unix(),
+		Complete:   false,
+		IP:         netip.MustParseAddr("127.0.0.1"),
+		Port:       0x4f50,
+		LastSeen:   time.Now().Unix(),
+		Uploaded:   100,
+		Downloaded: 200,
 	}
-	db.Save(peer.IP, peer.Port, peer.Complete, hash, peerid, peer.Uploaded, peer.Downloaded, false)
+	db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
+	db.Save(netip.MustParseAddr("::1"), netip.Addr{}, 0x4f51, true, false, hash, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(netip.MustParseAddr("127.0.0.2"), netip.Addr{}, 4000, true, false, hash, providerid, 0, 0, 0, &storage.ProviderClaim{Capacity: 8})
+	config.Config.Reputation.Max = 100
+	db.addReputation(peer.IP, 5)
+	oldReputation := *db.reputations[peer.IP]
+
+	db.shard(hash).hashmap[hash].Snatches = 7
+	db.shard(hash).hashmap[hash].Created = 1234567890
+
+	// announce state the behavior policy and stall detection rely on
+	slot, _ := db.shard(hash).hashmap[hash].Peers.get(peerid)
+	state := slot.peer()
+	state.AltIP = netip.MustParseAddr("2001:db8::1")
+	state.Left = 300
+	state.Stalled = 2
+	state.WindowStart = peer.LastSeen - 60
+	state.WindowUploaded = 40
+	state.WindowDownloaded = 80
+	state.UploadRate = 10
+	state.DownloadRate = 20
+	slot.set(&state)
+	db.shard(hash).hashmap[hash].Rates = storage.Rates{Upload: 10, Download: 20}
 
-	oldhahmap := db.hashmap
+	// referrals the load aware selections and authorised leechers rely on
+	db.shard(hash).hashmap[hash].BaselineProviders[providerid].refer(peerid, peer.LastSeen)
+
+	db.offenders[peer.IP] = &offender{offences: 3, lastOffence: peer.LastSeen, bannedUntil: peer.LastSeen + 600}
+
+	oldhahmap := db.shard(hash).hashmap
 	data, err := db.encodeBinary()
 	if err != nil {
 		t.Fatal("encodeBinary threw error: ", err)
 	}
 	db = Memory{}
-	if _, _, err := db.decodeBinary(data); err != nil {
+	if _, _, _, err := db.decodeBinary(data); err != nil {
 		t.Fatal("decodeBinary threw error: ", err)
 	}
 
-	if _, ok := db.hashmap[hash]; !ok {
+	if _, ok := db.shard(hash).hashmap[hash]; !ok {
 		t.Fatal("hashmap not equal, missing hash entry")
 	}
-	if oldhahmap[hash].Complete != db.hashmap[hash].Complete {
-		t.Fatalf("Complete not equal: should %v, got %v", oldhahmap[hash].Complete, db.hashmap[hash].Complete)
+	if oldhahmap[hash].Complete != db.shard(hash).hashmap[hash].Complete {
+		t.Fatalf("Complete not equal: should %v, got %v", oldhahmap[hash].Complete, db.shard(hash).hashmap[hash].Complete)
+	}
+	if oldhahmap[hash].Incomplete != db.shard(hash).hashmap[hash].Incomplete {
+		t.Fatalf("Incomplete not equal: should %v, got %v", oldhahmap[hash].Incomplete, db.shard(hash).hashmap[hash].Incomplete)
+	}
+	if oldhahmap[hash].Snatches != db.shard(hash).hashmap[hash].Snatches {
+		t.Fatalf("Snatches not equal: should %v, got %v", oldhahmap[hash].Snatches, db.shard(hash).hashmap[hash].Snatches)
 	}
-	if oldhahmap[hash].Incomplete != db.hashmap[hash].Incomplete {
-		t.Fatalf("Incomplete not equal: should %v, got %v", oldhahmap[hash].Incomplete, db.hashmap[hash].Incomplete)
+	if oldhahmap[hash].Rates != db.shard(hash).hashmap[hash].Rates {
+		t.Fatalf("Rates not equal: should %v, got %v", oldhahmap[hash].Rates, db.shard(hash).hashmap[hash].Rates)
+	}
+	if oldhahmap[hash].Created != db.shard(hash).hashmap[hash].Created {
+		t.Fatalf("Created not equal: should %v, got %v", oldhahmap[hash].Created, db.shard(hash).hashmap[hash].Created)
+	}
+	if !reflect.DeepEqual(peersByID(&oldhahmap[hash].Peers), peersByID(&db.shard(hash).hashmap[hash].Peers)) {
+		t.Fatalf("Peer not equal: should %v, got %v", peersByID(&oldhahmap[hash].Peers), peersByID(&db.shard(hash).hashmap[hash].Peers))
+	}
+	if !reflect.DeepEqual(oldhahmap[hash].BaselineProviders, db.shard(hash).hashmap[hash].BaselineProviders) {
+		t.Fatalf("BaselineProviders not equal: should %v, got %v", oldhahmap[hash].BaselineProviders, db.shard(hash).hashmap[hash].BaselineProviders)
+	}
+	if reputation, ok := db.reputations[peer.IP]; !ok || *reputation != oldReputation {
+		t.Fatalf("reputation not equal: should %v, got %v", oldReputation, reputation)
+	}
+	if o, ok := db.offenders[peer.IP]; !ok || *o != (offender{offences: 3, lastOffence: peer.LastSeen, bannedUntil: peer.LastSeen + 600}) {
+		t.Fatalf("offender not restored: got %+v", o)
+	}
+
+	// providers of removed trusted sources are dropped
+	config.Config.DB.TrustedSources = nil
+	if _, providers, _, err := db.decodeBinary(data); err != nil || providers != 0 {
+		t.Errorf("decodeBinary() without the source = %v providers, %v, want 0 providers", providers, err)
+	}
+}
+
+func TestDecodeBinaryV0(t *testing.T) {
+	pools.Initialize(10)
+
+	hash := storage.Hash{1}
+	peerid := storage.PeerID{2}
+	ip := netip.MustParseAddr("127.0.0.1")
+
+	// hash | peers | peerid | complete | addr length | addr | port | last seen
+	var buff bytes.Buffer
+	for _, v := range []any{hash, uint32(1), peerid, true, int32(4), ip.AsSlice(), uint16(4000), int64(1234567890)} {
+		binary.Write(&buff, binary.LittleEndian, v)
+	}
+
+	var db Memory
+	peers, providers, hashes, err := db.decodeBinary(buff.Bytes())
+	if err != nil {
+		t.Fatal("decodeBinary threw error: ", err)
+	}
+	if peers != 1 || providers != 0 || hashes != 1 {
+		t.Fatalf("decodeBinary() = %v peers %v providers %v hashes, want 1 0 1", peers, providers, hashes)
+	}
+
+	peer, ok := db.shard(hash).hashmap[hash].Peers.get(peerid)
+	if !ok || !peer.Complete || peer.ip() != ip || peer.Port != 4000 || peer.LastSeen != 1234567890 {
+		t.Errorf("decoded peer = %+v", peer)
 	}
-	if !reflect.DeepEqual(oldhahmap[hash].Peers, db.hashmap[hash].Peers) {
-		t.Fatalf("Peer not equal: should %v, got %v", oldhahmap[hash].Peers, db.hashmap[hash].Peers)
+	if db.shard(hash).hashmap[hash].Complete != 1 {
+		t.Errorf("Complete = %v, want 1", db.shard(hash).hashmap[hash].Complete)
 	}
 }
 
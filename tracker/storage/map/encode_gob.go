@@ -4,18 +4,62 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/gob"
+
+	"github.com/crimist/trakx/tracker/storage"
 )
 
+// gobPeerMap is the layout gob backups keep, peers are stored by id as they were before slabs
+type gobPeerMap struct {
+	Complete          uint16
+	Incomplete        uint16
+	Peers             map[storage.PeerID]*storage.Peer
+	BaselineProviders map[storage.PeerID]*Provider
+	Rates             storage.Rates
+	Created           int64
+	Snatches          uint32 // missing from older backups, decoded as 0
+}
+
 func (db *Memory) encodeGob() ([]byte, error) {
 	var buff bytes.Buffer
 	w := bufio.NewWriter(&buff)
 	encoder := gob.NewEncoder(w)
 
-	db.mutex.RLock()
-	if err := encoder.Encode(db.hashmap); err != nil {
+	// the backup holds a single hashmap regardless of the number of shards
+	hashmap := make(map[storage.Hash]*gobPeerMap)
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mutex.RLock()
+		for hash, peermap := range s.hashmap {
+			peermap.mutex.RLock()
+			submap := &gobPeerMap{
+				Complete:          peermap.Complete,
+				Incomplete:        peermap.Incomplete,
+				Peers:             make(map[storage.PeerID]*storage.Peer, peermap.Peers.len()),
+				BaselineProviders: make(map[storage.PeerID]*Provider, len(peermap.BaselineProviders)),
+				Rates:             peermap.Rates,
+				Created:           peermap.Created,
+				Snatches:          peermap.Snatches,
+			}
+			peermap.Peers.each(func(s *slot) bool {
+				peer := s.peer()
+				submap.Peers[s.ID] = &peer
+				return true
+			})
+			// copied as saves keep changing them once the lock is released
+			for id, provider := range peermap.BaselineProviders {
+				copied := *provider
+				copied.referred = nil // not kept by gob
+				submap.BaselineProviders[id] = &copied
+			}
+			peermap.mutex.RUnlock()
+			hashmap[hash] = submap
+		}
+		s.mutex.RUnlock()
+	}
+
+	if err := encoder.Encode(hashmap); err != nil {
 		return nil, err
 	}
-	db.mutex.RUnlock()
 
 	if err := w.Flush(); err != nil {
 		return nil, err
@@ -26,10 +70,35 @@ func (db *Memory) encodeGob() ([]byte, error) {
 
 func (db *Memory) decodeGob(data []byte) (err error) {
 	db.make()
+	defer db.index()
 	buff := bytes.NewBuffer(data)
 	decoder := gob.NewDecoder(bufio.NewReader(buff))
 
-	err = decoder.Decode(&db.hashmap)
+	var hashmap map[storage.Hash]*gobPeerMap
+	if err = decoder.Decode(&hashmap); err != nil {
+		return
+	}
+	for hash, submap := range hashmap {
+		peermap := &PeerMap{
+			Complete:          submap.Complete,
+			Incomplete:        submap.Incomplete,
+			Peers:             makePeers(len(submap.Peers)),
+			BaselineProviders: make(map[storage.PeerID]*Provider, len(submap.BaselineProviders)),
+			Rates:             submap.Rates,
+			Created:           submap.Created,
+			Snatches:          submap.Snatches,
+		}
+		for id, provider := range submap.BaselineProviders {
+			// providers of trusted sources removed since the backup aren't trusted anymore
+			if _, ok := db.trustedSources[provider.Source]; ok {
+				peermap.BaselineProviders[id] = provider
+			}
+		}
+		for id, peer := range submap.Peers {
+			peermap.Peers.put(id, peer)
+		}
+		db.shard(hash).hashmap[hash] = peermap
+	}
 
 	return
 }
@@ -6,10 +6,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
 func TestEncodeDecodeGob(t *testing.T) {
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "127.0.0.2", Port: 4000}, Name: "origin"},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
 	var db Memory
 	db.make()
 
@@ -23,9 +30,12 @@ func TestEncodeDecodeGob(t *testing.T) {
 		Uploaded:   1234,
 		Downloaded: 4321,
 	}
-	db.Save(peer.IP, peer.Port, peer.Complete, hash, peerid, peer.Uploaded, peer.Downloaded, false)
+	db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
+	db.Save(netip.MustParseAddr("127.0.0.2"), netip.Addr{}, 4000, true, false, hash, storage.PeerID{0x50}, 0, 0, 0, &storage.ProviderClaim{Capacity: 8})
 
-	oldhahmap := db.hashmap
+	db.shard(hash).hashmap[hash].Snatches = 7
+
+	oldhahmap := db.shard(hash).hashmap
 	data, err := db.encodeGob()
 	if err != nil {
 		t.Fatal("encodeGob threw error: ", err)
@@ -35,17 +45,29 @@ func TestEncodeDecodeGob(t *testing.T) {
 		t.Fatal("decodeGob threw error: ", err)
 	}
 
-	if _, ok := db.hashmap[hash]; !ok {
+	if _, ok := db.shard(hash).hashmap[hash]; !ok {
 		t.Fatal("hashmap not equal, missing hash entry")
 	}
-	if oldhahmap[hash].Complete != db.hashmap[hash].Complete {
-		t.Fatalf("Complete not equal: should %v, got %v", oldhahmap[hash].Complete, db.hashmap[hash].Complete)
+	if oldhahmap[hash].Complete != db.shard(hash).hashmap[hash].Complete {
+		t.Fatalf("Complete not equal: should %v, got %v", oldhahmap[hash].Complete, db.shard(hash).hashmap[hash].Complete)
+	}
+	if oldhahmap[hash].Incomplete != db.shard(hash).hashmap[hash].Incomplete {
+		t.Fatalf("Incomplete not equal: should %v, got %v", oldhahmap[hash].Incomplete, db.shard(hash).hashmap[hash].Incomplete)
 	}
-	if oldhahmap[hash].Incomplete != db.hashmap[hash].Incomplete {
-		t.Fatalf("Incomplete not equal: should %v, got %v", oldhahmap[hash].Incomplete, db.hashmap[hash].Incomplete)
+	if oldhahmap[hash].Snatches != db.shard(hash).hashmap[hash].Snatches {
+		t.Fatalf("Snatches not equal: should %v, got %v", oldhahmap[hash].Snatches, db.shard(hash).hashmap[hash].Snatches)
 	}
-	if !reflect.DeepEqual(oldhahmap[hash].Peers, db.hashmap[hash].Peers) {
-		t.Fatalf("Peer not equal: should %v, got %v", oldhahmap[hash].Peers, db.hashmap[hash].Peers)
+	if !reflect.DeepEqual(peersByID(&oldhahmap[hash].Peers), peersByID(&db.shard(hash).hashmap[hash].Peers)) {
+		t.Fatalf("Peer not equal: should %v, got %v", peersByID(&oldhahmap[hash].Peers), peersByID(&db.shard(hash).hashmap[hash].Peers))
+	}
+	if !reflect.DeepEqual(oldhahmap[hash].BaselineProviders, db.shard(hash).hashmap[hash].BaselineProviders) {
+		t.Fatalf("BaselineProviders not equal: should %v, got %v", oldhahmap[hash].BaselineProviders, db.shard(hash).hashmap[hash].BaselineProviders)
+	}
+
+	// providers of removed trusted sources are dropped
+	config.Config.DB.TrustedSources = nil
+	if err := db.decodeGob(data); err != nil || len(db.shard(hash).hashmap[hash].BaselineProviders) != 0 {
+		t.Errorf("decodeGob() without the source = %v providers, %v, want 0 providers", len(db.shard(hash).hashmap[hash].BaselineProviders), err)
 	}
 }
 
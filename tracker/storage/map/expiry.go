@@ -0,0 +1,166 @@
+package gomap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+const expireInterval = time.Second
+
+// expiry is a peer or baseline provider to check for expiry, entries of swarms have a zero id and only remove the swarm if empty
+type expiry struct {
+	hash     storage.Hash
+	id       storage.PeerID
+	provider bool
+}
+
+// expiries index the peers and baseline providers of a shard in buckets of the second they were last seen.
+// Every announce adds an entry without removing the previous one, entries of peers that announced again or were dropped are skipped once due.
+type expiries struct {
+	mutex   sync.Mutex
+	buckets map[int64][]expiry // by last seen unix second
+	next    int64              // oldest second not yet expired
+}
+
+// schedule indexes a peer or baseline provider by the second it was last seen
+func (s *shard) schedule(hash storage.Hash, id storage.PeerID, lastSeen int64, provider bool) {
+	s.expiries.mutex.Lock()
+	// seconds that were already expired are checked on the next pass
+	if lastSeen < s.expiries.next {
+		lastSeen = s.expiries.next
+	}
+	s.expiries.buckets[lastSeen] = append(s.expiries.buckets[lastSeen], expiry{hash: hash, id: id, provider: provider})
+	s.expiries.mutex.Unlock()
+}
+
+// due removes and returns the bucket of the oldest second before the cutoff, ok is false once every second before the cutoff is expired
+func (s *shard) due(cutoff int64) (entries []expiry, ok bool) {
+	s.expiries.mutex.Lock()
+	defer s.expiries.mutex.Unlock()
+
+	if s.expiries.next >= cutoff {
+		return nil, false
+	}
+	entries = s.expiries.buckets[s.expiries.next]
+	delete(s.expiries.buckets, s.expiries.next)
+	s.expiries.next++
+
+	return entries, true
+}
+
+// index schedules every swarm, peer and baseline provider and counts them towards the limits, used after decoding a backup
+func (db *Memory) index() {
+	now := time.Now().Unix()
+	for i := range db.shards {
+		s := &db.shards[i]
+		db.swarms.Add(int64(len(s.hashmap)))
+		for hash, peermap := range s.hashmap {
+			// empty swarms are removed once due like any other
+			s.schedule(hash, storage.PeerID{}, now, false)
+			db.peers.Add(int64(peermap.Peers.len()))
+			peermap.Peers.each(func(peer *slot) bool {
+				s.schedule(hash, peer.ID, peer.LastSeen, false)
+				db.countIP(peer.ip(), 1)
+				return true
+			})
+			for id, provider := range peermap.BaselineProviders {
+				s.schedule(hash, id, provider.LastSeen, true)
+			}
+		}
+	}
+}
+
+// expire removes the peers and baseline providers last seen more than DB.Expiry ago and the swarms left empty.
+// Only the buckets that fell due since the last pass are visited, one entry at a time.
+func (db *Memory) expire(now time.Time) (peers, baselineProviders, hashes int) {
+	expirySeconds := int64(config.Config.DB.Expiry.Seconds())
+	cutoff := now.Unix() - expirySeconds
+	lag := int64(-1)
+
+	for i := range db.shards {
+		s := &db.shards[i]
+		for {
+			entries, ok := s.due(cutoff)
+			if !ok {
+				break
+			}
+
+			for _, entry := range entries {
+				lastSeen, removed, emptied := s.expireEntry(db, entry, cutoff)
+				if emptied {
+					hashes++
+				}
+				if !removed {
+					continue
+				}
+				if entry.provider {
+					baselineProviders++
+				} else {
+					peers++
+				}
+
+				// peers are due once DB.Expiry passed since the end of the second they were last seen
+				if l := now.UnixMilli() - (lastSeen+expirySeconds+1)*1000; l > lag {
+					lag = l
+				}
+			}
+		}
+	}
+
+	if lag >= 0 {
+		stats.ExpiryLag.Store(lag)
+	}
+	stats.Expired.Add(int64(peers + baselineProviders))
+	db.expired.peers.Add(int64(peers))
+	db.expired.baselineProviders.Add(int64(baselineProviders))
+	db.expired.hashes.Add(int64(hashes))
+
+	return
+}
+
+// expireEntry removes the peer or baseline provider of the entry if it wasn't seen since the cutoff and its swarm if empty
+func (s *shard) expireEntry(db *Memory, entry expiry, cutoff int64) (lastSeen int64, removed, emptied bool) {
+	s.mutex.RLock()
+	peermap, ok := s.hashmap[entry.hash]
+	s.mutex.RUnlock()
+	if !ok {
+		return
+	}
+
+	peermap.mutex.Lock()
+	if entry.provider {
+		if provider, ok := peermap.BaselineProviders[entry.id]; ok && provider.LastSeen < cutoff {
+			lastSeen, removed = provider.LastSeen, true
+			db.deleteProvider(provider, peermap, entry.id)
+		}
+	} else {
+		if peer, ok := peermap.Peers.get(entry.id); ok && peer.LastSeen < cutoff {
+			lastSeen, removed = peer.LastSeen, true
+			db.delete(peermap, entry.id)
+		}
+	}
+	empty := peermap.Peers.len() == 0 && len(peermap.BaselineProviders) == 0
+	peermap.mutex.Unlock()
+
+	// entries of dropped peers still come due to remove the swarms they left empty
+	if !empty {
+		return
+	}
+
+	// check again with the shard locked, the swarm may have been joined in the meantime
+	s.mutex.Lock()
+	peermap.mutex.RLock()
+	if s.hashmap[entry.hash] == peermap && peermap.Peers.len() == 0 && len(peermap.BaselineProviders) == 0 {
+		delete(s.hashmap, entry.hash)
+		db.swarms.Add(-1)
+		emptied = true
+	}
+	peermap.mutex.RUnlock()
+	s.mutex.Unlock()
+
+	return
+}
@@ -0,0 +1,112 @@
+package gomap
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestExpire(t *testing.T) {
+	originalExpiry, originalSources := config.Config.DB.Expiry, config.Config.DB.TrustedSources
+	defer func() {
+		config.Config.DB.Expiry = originalExpiry
+		config.Config.DB.TrustedSources = originalSources
+	}()
+	config.Config.DB.Expiry = time.Minute
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	otherHash := storage.Hash{1}
+	db.Save(testIP, netip.Addr{}, 1000, true, false, testHash, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(testIP, netip.Addr{}, 1001, true, false, testHash, storage.PeerID{2}, 0, 0, 0, nil)
+	db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, storage.PeerID{3}, 0, 0, 0, &storage.ProviderClaim{})
+	db.Save(testIP, netip.Addr{}, 1000, true, false, otherHash, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Drop(otherHash, storage.PeerID{1}, netip.AddrPort{})
+	now := time.Now()
+
+	// nothing is due yet
+	if peers, providers, hashes := db.expire(now); peers+providers+hashes != 0 {
+		t.Fatalf("expire() = %v, %v, %v before anything was due", peers, providers, hashes)
+	}
+
+	// a peer that announced again isn't removed by its earlier entry
+	peermap, _ := db.peermap(testHash)
+	reannounced := now.Add(2 * time.Minute).Unix()
+	peer, _ := peermap.Peers.get(storage.PeerID{2})
+	peer.LastSeen = reannounced
+	db.shard(testHash).schedule(testHash, storage.PeerID{2}, reannounced, false)
+
+	// the swarm left empty by the dropped peer goes with it
+	later := now.Add(time.Minute + 2*time.Second)
+	if peers, providers, hashes := db.expire(later); peers != 1 || providers != 1 || hashes != 1 {
+		t.Errorf("expire() = %v, %v, %v, want 1 peer, 1 provider and 1 hash", peers, providers, hashes)
+	}
+	if _, ok := peermap.Peers.get(storage.PeerID{2}); !ok {
+		t.Error("expire() removed a peer that announced again")
+	}
+	if lag := stats.ExpiryLag.Load(); lag < 0 || lag > 2000 {
+		t.Errorf("ExpiryLag = %vms, want within 2s", lag)
+	}
+
+	// the swarm goes once its last peer expires
+	if peers, _, hashes := db.expire(now.Add(3*time.Minute + 2*time.Second)); peers != 1 || hashes != 1 {
+		t.Errorf("expire() = %v peers, %v hashes, want 1 and 1", peers, hashes)
+	}
+	if db.Hashes() != 0 {
+		t.Errorf("Hashes() = %v after every peer expired, want 0", db.Hashes())
+	}
+	for i := range db.shards {
+		if len(db.shards[i].expiries.buckets) != 0 {
+			t.Fatalf("shard %v kept %v buckets of expired seconds", i, len(db.shards[i].expiries.buckets))
+		}
+	}
+}
+
+func TestExpireEmptySwarm(t *testing.T) {
+	originalExpiry := config.Config.DB.Expiry
+	defer func() { config.Config.DB.Expiry = originalExpiry }()
+	config.Config.DB.Expiry = time.Minute
+
+	var db Memory
+	db.make()
+
+	// a swarm no peer ever joined has no peer entries to remove it
+	db.loadPeermap(testHash, false)
+	now := time.Now()
+	if _, _, hashes := db.expire(now); hashes != 0 {
+		t.Fatalf("expire() removed %v hashes before the swarm was due", hashes)
+	}
+	if _, _, hashes := db.expire(now.Add(time.Minute + 2*time.Second)); hashes != 1 || db.Hashes() != 0 {
+		t.Errorf("expire() = %v hashes leaving %v, want the empty swarm removed", hashes, db.Hashes())
+	}
+}
+
+// benchmarkExpireDue measures an expiry pass over a database of the given number of swarms when none of them are due, the cost shouldn't depend on the size
+func benchmarkExpireDue(b *testing.B, hashes int) {
+	originalExpiry := config.Config.DB.Expiry
+	defer func() { config.Config.DB.Expiry = originalExpiry }()
+	config.Config.DB.Expiry = time.Hour
+	pools.Initialize(10)
+
+	db := dbWithHashes(hashes)
+	now := time.Now()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.expire(now)
+	}
+}
+
+func BenchmarkExpireDue1000(b *testing.B)   { benchmarkExpireDue(b, 1000) }
+func BenchmarkExpireDue100000(b *testing.B) { benchmarkExpireDue(b, 100_000) }
@@ -10,22 +10,33 @@ func (db *Memory) SyncExpvars() error {
 		return errors.New("driver not initiated before SyncExpvars")
 	}
 
-	var seeds, leeches int64
+	var seeds, leeches, uploadRate, downloadRate int64
 
-	// Called on main thread before thread/queue dispatch no locking needed
-	for _, peermap := range db.hashmap {
-		for _, peer := range peermap.Peers {
-			stats.IPStats.Inc(peer.IP)
-			if peer.Complete {
-				seeds++
-			} else {
-				leeches++
-			}
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mutex.RLock()
+		for _, peermap := range s.hashmap {
+			peermap.mutex.RLock()
+			peermap.Peers.each(func(peer *slot) bool {
+				stats.IPStats.Inc(peer.ip())
+				uploadRate += peer.UploadRate
+				downloadRate += peer.DownloadRate
+				if peer.Complete {
+					seeds++
+				} else {
+					leeches++
+				}
+				return true
+			})
+			peermap.mutex.RUnlock()
 		}
+		s.mutex.RUnlock()
 	}
 
 	stats.Seeds.Store(seeds)
 	stats.Leeches.Store(leeches)
+	stats.UploadRate.Store(uploadRate)
+	stats.DownloadRate.Store(downloadRate)
 
 	return nil
 }
@@ -0,0 +1,34 @@
+package gomap
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/crimist/trakx/pools"
+)
+
+// benchmarkGC measures full garbage collections of a database holding the given number of peers.
+// ns/op is the time of a collection, most of it marking the heap the database holds.
+func benchmarkGC(b *testing.B, peers int) {
+	pools.Initialize(10)
+	db := dbWithHashesAndPeers(peers/benchPeers, benchPeers)
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(after.NumGC-before.NumGC), "pause-ns/gc")
+	b.ReportMetric(float64(after.HeapAlloc), "heap-bytes")
+	b.ReportMetric(float64(after.HeapObjects), "heap-objects")
+	runtime.KeepAlive(db)
+}
+
+func BenchmarkGC100k(b *testing.B) { benchmarkGC(b, 100_000) }
+func BenchmarkGC1M(b *testing.B)   { benchmarkGC(b, 1_000_000) }
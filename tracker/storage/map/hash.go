@@ -2,24 +2,30 @@ package gomap
 
 import (
 	"encoding/binary"
-	"errors"
-	"math/rand"
+	"math"
+	"net/netip"
+	"time"
 
 	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
 // Hashes gets the number of hashes
-func (db *Memory) Hashes() int {
-	// race condition but doesn't matter as it's just for metrics
-	return len(db.hashmap)
+func (db *Memory) Hashes() (hashes int) {
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mutex.RLock()
+		hashes += len(s.hashmap)
+		s.mutex.RUnlock()
+	}
+	return
 }
 
-// HashStats returns number of complete and incomplete peers associated with the hash
-func (db *Memory) HashStats(hash storage.Hash) (complete, incomplete uint16) {
-	db.mutex.RLock()
-	peermap, ok := db.hashmap[hash]
-	db.mutex.RUnlock()
+// HashStats returns number of complete and incomplete peers associated with the hash and the number of times it was downloaded
+func (db *Memory) HashStats(hash storage.Hash) (complete, incomplete uint16, downloaded uint32) {
+	peermap, ok := db.peermap(hash)
 	if !ok {
 		return
 	}
@@ -27,159 +33,321 @@ func (db *Memory) HashStats(hash storage.Hash) (complete, incomplete uint16) {
 	peermap.mutex.RLock()
 	complete = peermap.Complete
 	incomplete = peermap.Incomplete
+	downloaded = peermap.Snatches
 	peermap.mutex.RUnlock()
 
 	return
 }
 
-// Obtain one random baseline provider from the available ones in the swarm if possible
-func (db *Memory) BaselineProvider(hash storage.Hash, compact bool, removePeerId bool) (baselineProvider []byte, err error) {
-	db.mutex.RLock()
-	peermap, ok := db.hashmap[hash]
-	db.mutex.RUnlock()
+// Rates returns the summed transfer rates of the swarm and the transfer rates of each peer in it
+func (db *Memory) Rates(hash storage.Hash) (swarm storage.Rates, peers []storage.PeerRates) {
+	peermap, ok := db.peermap(hash)
 	if !ok {
-		return baselineProvider, errors.New("No peermap at specified hash found")
+		return
 	}
 
 	peermap.mutex.RLock()
+	swarm = peermap.Rates
+	peers = make([]storage.PeerRates, 0, peermap.Peers.len())
+	peermap.Peers.each(func(s *slot) bool {
+		peers = append(peers, storage.PeerRates{
+			ID:    s.ID,
+			IP:    s.ip(),
+			Port:  s.Port,
+			Rates: storage.Rates{Upload: s.UploadRate, Download: s.DownloadRate},
+		})
+		return true
+	})
+	peermap.mutex.RUnlock()
 
-	numBaselineProviders := len(peermap.BaselineProviders)
-	if numBaselineProviders == 0 {
-		peermap.mutex.RUnlock()
-		return baselineProvider, errors.New("No baseline provider for specified hash found")
-	}
-
-	// naive: Randomly choose a baseline provider and return it
-	randIndex := rand.Intn(numBaselineProviders)
-	for id, knownProvider := range peermap.BaselineProviders {
-		if randIndex == 0 {
-			if compact {
-				// if compact, put each byte based on IPV4/V6
-				if knownProvider.IP.Is6() {
-					baselineProvider = make([]byte, 18)
-					copy(baselineProvider[:16], knownProvider.IP.AsSlice())
-					binary.BigEndian.PutUint16(baselineProvider[16:18], knownProvider.Port)
-					baselineProvider = baselineProvider[:18]
-				} else {
-					baselineProvider = make([]byte, 6)
-					copy(baselineProvider[:4], knownProvider.IP.AsSlice())
-					binary.BigEndian.PutUint16(baselineProvider[4:6], knownProvider.Port)
-				}
-			} else {
-				// otherwise, use a dictionary and place necessary information
-				dictionary := pools.Dictionaries.Get()
-				if !removePeerId {
-					dictionary.String("peer id", string(id[:]))
-				}
-				dictionary.String("ip", knownProvider.IP.String())
-				dictionary.Int64("port", int64(knownProvider.Port))
-
-				dictBytes := dictionary.GetBytes()
-				baselineProvider := make([]byte, len(dictBytes))
-				copy(baselineProvider, dictBytes)
-
-				dictionary.Reset()
-				pools.Dictionaries.Put(dictionary)
-			}
+	return
+}
 
-			peermap.mutex.RUnlock()
-			return baselineProvider, nil
-		}
+// HandoutBaseline returns true if the handout rule of the hash allows handing baseline providers to the peer
+func (db *Memory) HandoutBaseline(hash storage.Hash, id storage.PeerID, penalty storage.Penalty) bool {
+	rule := db.handout.Rule(hash)
+	if rule == (config.HandoutRule{}) {
+		return true
+	}
 
-		randIndex -= 1
+	peermap, ok := db.peermap(hash)
+	if !ok {
+		return true
 	}
 
+	state := storage.HandoutState{Offences: penalty.Offences}
+	peermap.mutex.RLock()
+	state.Seeders = peermap.Complete
+	state.Age = time.Now().Unix() - peermap.Created
+	if s, ok := peermap.Peers.get(id); ok {
+		state.Stalled = s.Stalled
+	}
 	peermap.mutex.RUnlock()
-	return baselineProvider, errors.New("Baseline provider picking goes wrong")
+
+	if !storage.Handout(rule, state) {
+		stats.BaselineWithheld.Add(1)
+		return false
+	}
+	return true
 }
 
-// PeerList returns a peer list for the given hash capped at max
-func (db *Memory) PeerList(hash storage.Hash, numWant uint, removePeerId bool) (peers [][]byte) {
-	db.mutex.RLock()
-	peermap, ok := db.hashmap[hash]
-	db.mutex.RUnlock()
+// BaselineProviders returns up to numWant distinct baseline providers for the given hash, in the order picked by the configured selection strategy.
+// Each provider is encoded as compact bytes (6 bytes for IPv4, 18 for IPv6) or as a bencoded dictionary and the referral of the requesting peer is recorded.
+func (db *Memory) BaselineProviders(hash storage.Hash, requester storage.PeerID, numWant uint, compact bool, removePeerId bool) (providers [][]byte) {
+	peermap, ok := db.peermap(hash)
 	if !ok {
 		return
 	}
 
-	peermap.mutex.RLock()
+	// write lock as referrals are recorded on the picked providers
+	peermap.mutex.Lock()
 
-	if numPeers := uint(len(peermap.Peers)); numWant > numPeers {
-		numWant = numPeers
+	if numProviders := uint(len(peermap.BaselineProviders)); numWant > numProviders {
+		numWant = numProviders
 	}
 
 	if numWant == 0 {
-		peermap.mutex.RUnlock()
+		peermap.mutex.Unlock()
 		return
 	}
 
-	var i uint
-	peers = make([][]byte, numWant)
+	candidates := make([]*Provider, 0, len(peermap.BaselineProviders))
+	ids := make(map[*Provider]storage.PeerID, len(peermap.BaselineProviders))
+	for id, provider := range peermap.BaselineProviders {
+		candidates = append(candidates, provider)
+		ids[provider] = id
+	}
+
+	selector := db.selector
+	if selector == nil {
+		selector = selectRandom
+	}
+
+	now := time.Now().Unix()
+	providers = make([][]byte, 0, numWant)
+	for uint(len(providers)) < numWant {
+		picked := selector(candidates, now)
+		picked.refer(requester, now)
+		providers = append(providers, encodeProvider(ids[picked], picked, compact, removePeerId))
+
+		// remove the pick so every provider is distinct
+		for i, candidate := range candidates {
+			if candidate == picked {
+				candidates[i] = candidates[len(candidates)-1]
+				candidates = candidates[:len(candidates)-1]
+				break
+			}
+		}
+	}
+
+	peermap.mutex.Unlock()
+	return
+}
+
+// encodeProvider encodes the baseline provider as compact bytes or as a bencoded dictionary
+func encodeProvider(id storage.PeerID, provider *Provider, compact bool, removePeerId bool) []byte {
+	if compact {
+		// if compact, put each byte based on IPV4/V6
+		if provider.IP.Is6() {
+			encoded := make([]byte, 18)
+			copy(encoded[:16], provider.IP.AsSlice())
+			binary.BigEndian.PutUint16(encoded[16:18], provider.Port)
+			return encoded
+		}
+
+		encoded := make([]byte, 6)
+		copy(encoded[:4], provider.IP.AsSlice())
+		binary.BigEndian.PutUint16(encoded[4:6], provider.Port)
+		return encoded
+	}
+
+	// otherwise, use a dictionary and place necessary information
 	dictionary := pools.Dictionaries.Get()
+	if !removePeerId {
+		dictionary.String("peer id", string(id[:]))
+	}
+	dictionary.String("ip", provider.IP.String())
+	dictionary.Int64("port", int64(provider.Port))
+
+	dictBytes := dictionary.GetBytes()
+	encoded := make([]byte, len(dictBytes))
+	copy(encoded, dictBytes)
 
-	for id, peer := range peermap.Peers {
+	dictionary.Reset()
+	pools.Dictionaries.Put(dictionary)
+
+	return encoded
+}
+
+// disreputable returns true if the address has a negative reputation, the caller must hold the reputation read lock
+func (db *Memory) disreputable(ip netip.Addr) bool {
+	r, ok := db.reputations[ip]
+	return ok && r.score < 0
+}
+
+// pick samples up to numWant peers of the swarm for the requester, the caller must hold the peermap read lock.
+// The requester is left out of its own list. Seeds get leechers first, leechers get a Numwant.Seeds share of seeds
+// and the rest leechers, either filling in for the other when there aren't enough.
+// A Numwant.Local share of each is given to the peers closest to the requester, see rankLocal.
+// Peers with a negative reputation are placed last, they only fill the slots left by the others.
+// Good actors get peers with recent offences as set by Numwant.Offenders and a bigger seed share the more reputable they are.
+func (db *Memory) pick(peermap *PeerMap, requester storage.Requester, numWant uint) []*slot {
+	if numPeers := uint(peermap.Peers.len()); numWant > numPeers {
+		numWant = numPeers
+	}
+	if numWant == 0 {
+		return nil
+	}
+
+	goodActor := requester.Penalty.GoodActor()
+	var seedsWant uint
+	if !requester.Complete {
+		share := config.Config.Numwant.Seeds
+		if max := config.Config.Reputation.Max; goodActor && requester.Penalty.Reputation > 0 && config.Config.Numwant.Reputable > 0 && max > 0 {
+			share += config.Config.Numwant.Reputable * math.Min(requester.Penalty.Reputation/max, 1)
+			stats.PeerListsBoosted.Add(1)
+		}
+		seedsWant = uint(math.Round(float64(numWant) * math.Min(share, 1)))
+	}
+	leechesWant := numWant - seedsWant
+
+	// ranking by locality needs more candidates than are handed out
+	scan := uint(1)
+	local := config.Config.Numwant.Local > 0 && requester.IP.IsValid()
+	if local {
+		scan = localityScan
+	}
+
+	// offenders are only kept from good actors, bad actors may as well get each other
+	offenders := config.Config.Numwant.Offenders
+	if !goodActor {
+		offenders = config.OffendersAny
+	}
+	now := time.Now().Unix()
+
+	seeds := make([]*slot, 0, numWant*scan)
+	leeches := make([]*slot, 0, numWant*scan)
+	var deferred []*slot
+	var demoted, omitted int64
+	db.reputationMutex.RLock()
+	db.offenderMutex.RLock()
+	peermap.Peers.each(func(s *slot) bool {
+		ip := s.ip()
+		switch {
+		case s.ID == requester.ID:
+		case offenders != config.OffendersAny && db.offending(ip, now):
+			if offenders == config.OffendersOmit {
+				omitted++
+			} else if uint(len(deferred)) < numWant {
+				deferred = append(deferred, s)
+				demoted++
+			}
+		case db.disreputable(ip):
+			if uint(len(deferred)) < numWant {
+				deferred = append(deferred, s)
+			}
+		case s.Complete:
+			if uint(len(seeds)) < numWant*scan {
+				seeds = append(seeds, s)
+			}
+		default:
+			if uint(len(leeches)) < numWant*scan {
+				leeches = append(leeches, s)
+			}
+		}
+		// stop once both shares are filled, otherwise look for peers to fill in for the missing ones
+		return uint(len(seeds)) < seedsWant*scan || uint(len(leeches)) < leechesWant*scan
+	})
+	db.offenderMutex.RUnlock()
+	db.reputationMutex.RUnlock()
+	stats.PeerListsDemoted.Add(demoted)
+	stats.PeerListsOmitted.Add(omitted)
+
+	// whatever share isn't filled goes to the other kind of peer
+	if short := uint(len(seeds)); short < seedsWant {
+		leechesWant += seedsWant - short
+		seedsWant = short
+	}
+	if short := uint(len(leeches)); short < leechesWant {
+		seedsWant += leechesWant - short
+		leechesWant = short
+	}
+	if seedsWant > uint(len(seeds)) {
+		seedsWant = uint(len(seeds))
+	}
+
+	if local {
+		network := db.locality.Network(requester.IP)
+		db.rankLocal(seeds, requester.IP, network, seedsWant)
+		db.rankLocal(leeches, requester.IP, network, leechesWant)
+	}
+
+	picked := append(leeches[:leechesWant], seeds[:seedsWant]...)
+	for i := 0; uint(len(picked)) < numWant && i < len(deferred); i++ {
+		picked = append(picked, deferred[i])
+	}
+	return picked
+}
+
+// PeerList returns a peer list of the given hash for the requester capped at numWant, see pick
+func (db *Memory) PeerList(hash storage.Hash, requester storage.Requester, numWant uint, removePeerId bool) (peers [][]byte) {
+	peermap, ok := db.peermap(hash)
+	if !ok {
+		return
+	}
+
+	peermap.mutex.RLock()
+	picked := db.pick(peermap, requester, numWant)
+	if len(picked) == 0 {
+		peermap.mutex.RUnlock()
+		return
+	}
+
+	peers = make([][]byte, 0, len(picked))
+	dictionary := pools.Dictionaries.Get()
+	for _, s := range picked {
 		if !removePeerId {
-			dictionary.String("peer id", string(id[:]))
+			dictionary.String("peer id", string(s.ID[:]))
 		}
-		dictionary.String("ip", peer.IP.String())
-		dictionary.Int64("port", int64(peer.Port))
+		dictionary.String("ip", s.ip().String())
+		dictionary.Int64("port", int64(s.Port))
 
 		dictBytes := dictionary.GetBytes()
-		peers[i] = make([]byte, len(dictBytes))
-		copy(peers[i], dictBytes)
+		encoded := make([]byte, len(dictBytes))
+		copy(encoded, dictBytes)
+		peers = append(peers, encoded)
 
 		dictionary.Reset()
-
-		i++
-		if i == numWant {
-			break
-		}
 	}
-
 	peermap.mutex.RUnlock()
 	pools.Dictionaries.Put(dictionary)
 
 	return
 }
 
-// PeerListBytes returns a byte encoded peer list for the given hash capped at num
-func (db *Memory) PeerListBytes(hash storage.Hash, numWant uint) (peers4 []byte, peers6 []byte) {
+// PeerListBytes returns a byte encoded peer list of the given hash for the requester capped at numWant, see pick
+func (db *Memory) PeerListBytes(hash storage.Hash, requester storage.Requester, numWant uint) (peers4 []byte, peers6 []byte) {
 	peers4 = pools.Peerlists4.Get()
 	peers6 = pools.Peerlists6.Get()
 
-	db.mutex.RLock()
-	peermap, ok := db.hashmap[hash]
-	db.mutex.RUnlock()
+	peermap, ok := db.peermap(hash)
 	if !ok {
 		return
 	}
 
 	peermap.mutex.RLock()
-	if numPeers := uint(len(peermap.Peers)); numWant > numPeers {
-		numWant = numPeers
-	}
-
-	if numWant == 0 {
-		peermap.mutex.RUnlock()
-		return
-	}
-
 	var pos4, pos6 int
-	for _, peer := range peermap.Peers {
-		if peer.IP.Is6() {
-			copy(peers6[pos6:pos6+16], peer.IP.AsSlice())
-			binary.BigEndian.PutUint16(peers6[pos6+16:pos6+18], peer.Port)
-			pos6 += 18
-			if pos6+18 > cap(peers6) {
-				break
-			}
-		} else {
-			copy(peers4[pos4:pos4+4], peer.IP.AsSlice())
-			binary.BigEndian.PutUint16(peers4[pos4+4:pos4+6], peer.Port)
+	// dual-stack peers are in both lists
+	for _, s := range db.pick(peermap, requester, numWant) {
+		if addr := s.addr4(); addr != nil && pos4+6 <= cap(peers4) {
+			copy(peers4[pos4:pos4+4], addr)
+			binary.BigEndian.PutUint16(peers4[pos4+4:pos4+6], s.Port)
 			pos4 += 6
-			if pos4+6 > cap(peers4) {
-				break
-			}
+		}
+		if addr := s.addr6(); addr != nil && pos6+18 <= cap(peers6) {
+			copy(peers6[pos6:pos6+16], addr)
+			binary.BigEndian.PutUint16(peers6[pos6+16:pos6+18], s.Port)
+			pos6 += 18
 		}
 	}
 	peermap.mutex.RUnlock()
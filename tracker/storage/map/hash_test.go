@@ -1,10 +1,15 @@
 package gomap
 
 import (
+	"bytes"
 	"math/rand"
 	"net/netip"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
@@ -28,7 +33,7 @@ func dbWithHashesAndPeers(hashes, peers int) *Memory {
 
 		for i := 0; i < peers; i++ {
 			rand.Read(peerid[:])
-			db.Save(peer.IP, peer.Port, peer.Complete, h, peerid, peer.Uploaded, peer.Downloaded, false)
+			db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, h, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
 		}
 	}
 
@@ -53,7 +58,7 @@ func dbWithHashes(count int) *Memory {
 		rand.Read(hash)
 		copy(h[:], hash)
 
-		db.Save(peer.IP, peer.Port, peer.Complete, h, peerid, peer.Uploaded, peer.Downloaded, false)
+		db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, h, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
 	}
 
 	return &db
@@ -78,12 +83,208 @@ func dbWithPeers(count int) (*Memory, storage.Hash) {
 		rand.Read(peerid)
 		copy(p[:], peerid)
 
-		db.Save(peer.IP, peer.Port, peer.Complete, hash, p, peer.Uploaded, peer.Downloaded, false)
+		db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, p, peer.Uploaded, peer.Downloaded, 0, nil)
 	}
 
 	return &db, hash
 }
 
+func TestBaselineProviders(t *testing.T) {
+	config.Config.Baseline.ReferralWindow = 10 * time.Minute
+
+	var db Memory
+	db.make()
+	db.selector = selectLeastLoaded
+
+	peermap, _ := db.loadPeermap(testHash, false)
+	addrs := []netip.AddrPort{
+		netip.MustParseAddrPort("1.2.3.4:1000"),
+		netip.MustParseAddrPort("1.2.3.5:1000"),
+		netip.MustParseAddrPort("[::1]:1000"),
+	}
+	for i, addr := range addrs {
+		provider := new(Provider)
+		provider.IP = addr.Addr()
+		provider.Port = addr.Port()
+		peermap.BaselineProviders[storage.PeerID{byte(i)}] = provider
+	}
+
+	if providers := db.BaselineProviders(testHash, testId, 2, true, true); len(providers) != 2 {
+		t.Fatalf("len(BaselineProviders(2)) = %v, want 2", len(providers))
+	}
+
+	// the provider left out above is the least loaded so it must be picked first
+	providers := db.BaselineProviders(testHash, testId, 10, true, true)
+	if len(providers) != len(addrs) {
+		t.Fatalf("len(BaselineProviders(10)) = %v, want %v", len(providers), len(addrs))
+	}
+	for _, provider := range peermap.BaselineProviders {
+		if provider.referrals != 2 && provider.referrals != 1 {
+			t.Errorf("provider referrals = %v, want 1 or 2", provider.referrals)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, provider := range providers {
+		if len(provider) != 6 && len(provider) != 18 {
+			t.Errorf("compact provider length = %v", len(provider))
+		}
+		if seen[string(provider)] {
+			t.Errorf("provider %v returned twice", provider)
+		}
+		seen[string(provider)] = true
+
+		if i > 0 {
+			continue
+		}
+		for _, p := range peermap.BaselineProviders {
+			if bytes.Equal(encodeProvider(storage.PeerID{}, p, true, true), provider) && p.referrals != 1 {
+				t.Errorf("first provider had %v referrals, want the least loaded", p.referrals)
+			}
+		}
+	}
+
+	if providers := db.BaselineProviders(storage.Hash{}, testId, 10, true, true); providers != nil {
+		t.Errorf("BaselineProviders() for unknown hash = %v, want nil", providers)
+	}
+}
+
+func TestPeerList(t *testing.T) {
+	defer func(seeds float64) { config.Config.Numwant.Seeds = seeds }(config.Config.Numwant.Seeds)
+	config.Config.Numwant.Seeds = 0.5
+	pools.Initialize(10)
+
+	var db Memory
+	db.make()
+
+	// peers 0-3 are seeds and 4-7 leechers
+	for i := byte(0); i < 8; i++ {
+		db.Save(netip.AddrFrom4([4]byte{10, 0, 0, i}), netip.Addr{}, 1000, i < 4, false, testHash, storage.PeerID{i}, 0, 0, 0, nil)
+	}
+	peermap, _ := db.peermap(testHash)
+
+	count := func(picked []*slot, requester storage.PeerID) (seeds, leeches int) {
+		for _, s := range picked {
+			if s.ID == requester {
+				t.Fatalf("requester %v in its own peer list", requester[0])
+			}
+			if s.Complete {
+				seeds++
+			} else {
+				leeches++
+			}
+		}
+		return
+	}
+
+	first := make(map[storage.PeerID]bool)
+	for i := 0; i < 50; i++ {
+		picked := db.pick(peermap, storage.Requester{ID: storage.PeerID{4}}, 4)
+		if seeds, leeches := count(picked, storage.PeerID{4}); seeds != 2 || leeches != 2 {
+			t.Fatalf("leecher got %v seeds and %v leechers, want 2 and 2", seeds, leeches)
+		}
+		first[picked[0].ID] = true
+
+		// seeds get every leecher before any seed
+		picked = db.pick(peermap, storage.Requester{ID: storage.PeerID{0}, Complete: true}, 5)
+		if seeds, leeches := count(picked, storage.PeerID{0}); seeds != 1 || leeches != 4 {
+			t.Fatalf("seed got %v seeds and %v leechers, want 1 and 4", seeds, leeches)
+		}
+	}
+	if len(first) < 2 {
+		t.Error("peer lists always start with the same peer")
+	}
+
+	// leechers fill in for missing seeds and the other way around
+	db.Drop(testHash, storage.PeerID{1}, netip.AddrPort{})
+	db.Drop(testHash, storage.PeerID{2}, netip.AddrPort{})
+	db.Drop(testHash, storage.PeerID{3}, netip.AddrPort{})
+	if seeds, leeches := count(db.pick(peermap, storage.Requester{ID: storage.PeerID{4}}, 4), storage.PeerID{4}); seeds != 1 || leeches != 3 {
+		t.Errorf("leecher got %v seeds and %v leechers with one seed, want 1 and 3", seeds, leeches)
+	}
+	if picked := db.pick(peermap, storage.Requester{ID: storage.PeerID{4}}, 10); len(picked) != 4 {
+		t.Errorf("pick() = %v peers, want every peer but the requester", len(picked))
+	}
+
+	peers4, peers6 := db.PeerListBytes(testHash, storage.Requester{ID: storage.PeerID{4}}, 10)
+	if len(peers4) != 4*6 || len(peers6) != 0 {
+		t.Errorf("PeerListBytes() = %v bytes, want 4 peers", len(peers4))
+	}
+	pools.Peerlists4.Put(peers4)
+	pools.Peerlists6.Put(peers6)
+}
+
+func TestPeerListLocality(t *testing.T) {
+	defer func(local float64) { config.Config.Numwant.Local = local }(config.Config.Numwant.Local)
+	config.Config.Numwant.Local = 0.5
+
+	var db Memory
+	db.make()
+	var err error
+	if db.locality, err = storage.ParseLocality(strings.NewReader("10.0.0.0/8 AS64500")); err != nil {
+		t.Fatal(err)
+	}
+
+	requester := storage.Requester{ID: storage.PeerID{0}, IP: netip.MustParseAddr("10.0.0.1")}
+	db.Save(requester.IP, netip.Addr{}, 1000, false, false, testHash, requester.ID, 0, 0, 0, nil)
+	db.Save(netip.MustParseAddr("10.0.0.2"), netip.Addr{}, 1000, false, false, testHash, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(netip.MustParseAddr("10.9.0.1"), netip.Addr{}, 1000, false, false, testHash, storage.PeerID{2}, 0, 0, 0, nil)
+	// few enough for every peer to be a candidate
+	for i := byte(3); i < 15; i++ {
+		db.Save(netip.AddrFrom4([4]byte{192, 168, i, 1}), netip.Addr{}, 1000, false, false, testHash, storage.PeerID{i}, 0, 0, 0, nil)
+	}
+	peermap, _ := db.peermap(testHash)
+
+	// the subnet comes before the network, the other half stays random
+	rest := make(map[storage.PeerID]bool)
+	for i := 0; i < 50; i++ {
+		picked := db.pick(peermap, requester, 4)
+		if len(picked) != 4 || picked[0].ID != (storage.PeerID{1}) || picked[1].ID != (storage.PeerID{2}) {
+			t.Fatal("pick() didn't rank the nearby peers first")
+		}
+		rest[picked[2].ID] = true
+	}
+	if len(rest) < 2 {
+		t.Error("peers after the nearby ones aren't random")
+	}
+
+	// without a network only the subnet is nearby
+	db.locality = nil
+	if picked := db.pick(peermap, requester, 4); picked[0].ID != (storage.PeerID{1}) {
+		t.Errorf("pick() = %v first, want the peer in the same subnet", picked[0].ID[0])
+	}
+}
+
+func TestHashStatsSnatches(t *testing.T) {
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	hash := storage.Hash{5}
+	leecher, seed, newcomer := storage.PeerID{1}, storage.PeerID{2}, storage.PeerID{3}
+	ip := netip.MustParseAddr("1.2.3.4")
+
+	db.Save(ip, netip.Addr{}, 1000, false, false, hash, leecher, 0, 0, 100, nil)
+	db.Save(ip, netip.Addr{}, 1001, true, false, hash, seed, 0, 0, 0, nil) // seeding from the start isn't a download
+	if _, _, downloaded := db.HashStats(hash); downloaded != 0 {
+		t.Fatalf("HashStats() downloaded = %v before any completed event, want 0", downloaded)
+	}
+
+	db.Save(ip, netip.Addr{}, 1000, true, true, hash, leecher, 0, 100, 0, nil)
+	db.Save(ip, netip.Addr{}, 1000, true, true, hash, leecher, 0, 100, 0, nil) // duplicate
+	db.Save(ip, netip.Addr{}, 1001, true, true, hash, seed, 0, 0, 0, nil)      // already complete
+	if _, _, downloaded := db.HashStats(hash); downloaded != 1 {
+		t.Fatalf("HashStats() downloaded = %v after a leecher completed, want 1", downloaded)
+	}
+
+	// peers the tracker didn't know about yet count on their completed event
+	db.Save(ip, netip.Addr{}, 1002, true, true, hash, newcomer, 0, 100, 0, nil)
+	complete, incomplete, downloaded := db.HashStats(hash)
+	if complete != 3 || incomplete != 0 || downloaded != 2 {
+		t.Errorf("HashStats() = %v, %v, %v, want 3, 0, 2", complete, incomplete, downloaded)
+	}
+}
+
 func benchmarkHashes(b *testing.B, count int) {
 	db := dbWithHashes(count)
 
@@ -106,7 +307,7 @@ func benchmarkPeerList(b *testing.B, cap uint) {
 
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		db.PeerList(hash, cap, false)
+		db.PeerList(hash, storage.Requester{}, cap, false)
 	}
 }
 
@@ -120,7 +321,7 @@ func benchmarkPeerListNopeerid(b *testing.B, cap uint) {
 
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		db.PeerList(hash, cap, true)
+		db.PeerList(hash, storage.Requester{}, cap, true)
 	}
 }
 
@@ -134,7 +335,7 @@ func benchmarkPeerListBytes(b *testing.B, cap uint) {
 
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		db.PeerListBytes(hash, cap)
+		db.PeerListBytes(hash, storage.Requester{}, cap)
 	}
 }
 
@@ -154,3 +355,29 @@ func benchmarkHashStats(b *testing.B, peers int) {
 
 func BenchmarkHashStats100(b *testing.B)  { benchmarkHashStats(b, 100) }
 func BenchmarkHashStats1000(b *testing.B) { benchmarkHashStats(b, 1000) }
+
+func TestHandoutBaseline(t *testing.T) {
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	rules, err := storage.ParseHandoutRules(config.HandoutRule{Stalled: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.handout = rules
+
+	// left stays the same for two announces after the first
+	for i, left := range []int64{100, 100, 100} {
+		db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 0, left, nil)
+		if handout, want := db.HandoutBaseline(testHash, testId, storage.Penalty{}), i == 2; handout != want {
+			t.Errorf("HandoutBaseline() after %v announces = %v, want %v", i+1, handout, want)
+		}
+	}
+
+	// progress resets the stall
+	db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 0, 50, nil)
+	if db.HandoutBaseline(testHash, testId, storage.Penalty{}) {
+		t.Error("HandoutBaseline() = true after progress, want false")
+	}
+}
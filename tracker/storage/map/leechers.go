@@ -0,0 +1,71 @@
+package gomap
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// AuthorizedLeechers returns the peers referred to the baseline provider within Baseline.Authorized that are still good actors.
+// The request is authenticated like an announce of the provider, the provider must be registered for the hash through the same source.
+// Dual-stack peers are returned once for each of their addresses.
+func (db *Memory) AuthorizedLeechers(ip netip.Addr, port uint16, hash storage.Hash, id storage.PeerID, claim *storage.ProviderClaim) ([]storage.Leecher, error) {
+	source := db.authenticate(ip, port, claim, storage.LeechersMessage(hash, id, port, claim.Timestamp))
+	if source == nil {
+		return nil, storage.ErrUntrustedProvider
+	}
+
+	peermap, ok := db.peermap(hash)
+	if !ok {
+		return nil, storage.ErrUnknownProvider
+	}
+
+	oldest := time.Now().Unix() - int64(config.Config.Baseline.Authorized.Seconds())
+	type referral struct {
+		storage.Leecher
+		alt netip.Addr
+	}
+	var referred []referral
+
+	peermap.mutex.RLock()
+	provider, ok := peermap.BaselineProviders[id]
+	if !ok || provider.Source != source.Name {
+		peermap.mutex.RUnlock()
+		return nil, storage.ErrUnknownProvider
+	}
+	for peerID, referredAt := range provider.referred {
+		if referredAt < oldest {
+			continue
+		}
+		if s, ok := peermap.Peers.get(peerID); ok {
+			referred = append(referred, referral{Leecher: storage.Leecher{ID: peerID, IP: s.ip(), Port: s.Port}, alt: s.alt()})
+		}
+	}
+	peermap.mutex.RUnlock()
+
+	// penalties are looked up without holding the peermap lock, offences are recorded against the address peers announce from
+	leechers := make([]storage.Leecher, 0, len(referred))
+	for _, r := range referred {
+		if !db.Penalty(r.IP).GoodActor() {
+			continue
+		}
+		leechers = append(leechers, r.Leecher)
+		if r.alt.IsValid() {
+			leechers = append(leechers, storage.Leecher{ID: r.ID, IP: r.alt, Port: r.Port})
+		}
+	}
+
+	return leechers, nil
+}
+
+// trimReferred forgets referrals older than Baseline.Authorized, the caller must hold the peermap write lock
+func (provider *Provider) trimReferred(now int64) {
+	oldest := now - int64(config.Config.Baseline.Authorized.Seconds())
+	for id, referredAt := range provider.referred {
+		if referredAt < oldest {
+			delete(provider.referred, id)
+		}
+	}
+}
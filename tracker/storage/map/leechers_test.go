@@ -0,0 +1,69 @@
+package gomap
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestAuthorizedLeechers(t *testing.T) {
+	originalBaseline, originalBehavior := config.Config.Baseline, config.Config.Behavior
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	defer func() {
+		config.Config.Baseline, config.Config.Behavior = originalBaseline, originalBehavior
+		config.Config.DB.TrustedSources = nil
+	}()
+	config.Config.Baseline.Authorized = time.Hour
+	config.Config.Behavior.Penalty.Forget = time.Hour
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	provider := storage.PeerID{1}
+	good, bad, unreferred := storage.PeerID{2}, storage.PeerID{3}, storage.PeerID{4}
+	goodIP, badIP := netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")
+	goodAlt := netip.MustParseAddr("2001:db8::1")
+
+	if !db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, provider, 0, 0, 0, &storage.ProviderClaim{}) {
+		t.Fatal("baseline provider was not accepted")
+	}
+	db.Save(goodIP, goodAlt, 5000, false, false, testHash, good, 0, 0, 100, nil)
+	db.Save(badIP, netip.Addr{}, 5000, false, false, testHash, bad, 0, 0, 100, nil)
+	db.Save(goodIP, netip.Addr{}, 5001, false, false, testHash, unreferred, 0, 0, 100, nil)
+	db.BaselineProviders(testHash, good, 1, true, true)
+	db.BaselineProviders(testHash, bad, 1, true, true)
+	db.offend(badIP)
+
+	leechers, err := db.AuthorizedLeechers(testIP, 4000, testHash, provider, &storage.ProviderClaim{})
+	if err != nil {
+		t.Fatal("AuthorizedLeechers() threw error:", err)
+	}
+	// the good leecher is dual-stack
+	want := []storage.Leecher{{ID: good, IP: goodIP, Port: 5000}, {ID: good, IP: goodAlt, Port: 5000}}
+	if !reflect.DeepEqual(leechers, want) {
+		t.Errorf("AuthorizedLeechers() = %+v, want both addresses of the good referred leecher", leechers)
+	}
+
+	if _, err := db.AuthorizedLeechers(testIP, 4001, testHash, provider, &storage.ProviderClaim{}); !errors.Is(err, storage.ErrUntrustedProvider) {
+		t.Errorf("AuthorizedLeechers() from another port = %v, want %v", err, storage.ErrUntrustedProvider)
+	}
+	if _, err := db.AuthorizedLeechers(testIP, 4000, testHash, good, &storage.ProviderClaim{}); !errors.Is(err, storage.ErrUnknownProvider) {
+		t.Errorf("AuthorizedLeechers() for a leecher = %v, want %v", err, storage.ErrUnknownProvider)
+	}
+
+	// referrals expire
+	db.shard(testHash).hashmap[testHash].BaselineProviders[provider].trimReferred(time.Now().Add(2 * time.Hour).Unix())
+	if leechers, _ := db.AuthorizedLeechers(testIP, 4000, testHash, provider, &storage.ProviderClaim{}); len(leechers) != 0 {
+		t.Errorf("AuthorizedLeechers() after expiry = %+v, want none", leechers)
+	}
+}
@@ -0,0 +1,170 @@
+package gomap
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// evictScan is the max number of expiry entries checked for a peer to evict from a shard
+const evictScan = 64
+
+// admit returns true if a new peer of the address may join the swarm of the hash, peermap is nil if the swarm doesn't exist yet.
+// New swarms are held to DB.Limits.Swarms as they're created by loadPeermap.
+// Swarms with baseline providers are protected, once full the least recently seen peers are evicted to make room rather than rejecting the new peer.
+func (db *Memory) admit(hash storage.Hash, peermap *PeerMap, ip netip.Addr) bool {
+	limits := &config.Config.DB.Limits
+
+	if limits.IPSwarms > 0 && db.ipPeers(ip) >= limits.IPSwarms {
+		stats.RejectedIPSwarms.Add(1)
+		return false
+	}
+
+	var peers int
+	var protected bool
+	if peermap != nil {
+		peermap.mutex.RLock()
+		peers = peermap.Peers.len()
+		protected = len(peermap.BaselineProviders) > 0
+		peermap.mutex.RUnlock()
+	}
+
+	if limits.SwarmPeers > 0 && peers >= int(limits.SwarmPeers) {
+		if !protected || !db.evictStalest(peermap) {
+			stats.RejectedSwarmPeers.Add(1)
+			return false
+		}
+		stats.EvictedSwarmPeers.Add(1)
+	}
+	if limits.Peers > 0 && db.peers.Load() >= int64(limits.Peers) {
+		if !protected || !db.evict(hash) {
+			stats.RejectedPeers.Add(1)
+			return false
+		}
+		stats.EvictedPeers.Add(1)
+	}
+
+	return true
+}
+
+// countSwarm counts a new swarm, returning false without counting it if it would exceed DB.Limits.Swarms
+func (db *Memory) countSwarm() bool {
+	limit := int64(config.Config.DB.Limits.Swarms)
+	for {
+		swarms := db.swarms.Load()
+		if limit > 0 && swarms >= limit {
+			stats.RejectedSwarms.Add(1)
+			return false
+		}
+		if db.swarms.CompareAndSwap(swarms, swarms+1) {
+			return true
+		}
+	}
+}
+
+// evictStalest removes the least recently seen peer of the swarm
+func (db *Memory) evictStalest(peermap *PeerMap) bool {
+	peermap.mutex.Lock()
+	defer peermap.mutex.Unlock()
+
+	var stalest *slot
+	peermap.Peers.each(func(peer *slot) bool {
+		if stalest == nil || peer.LastSeen < stalest.LastSeen {
+			stalest = peer
+		}
+		return true
+	})
+	if stalest == nil {
+		return false
+	}
+
+	db.delete(peermap, stalest.ID)
+	return true
+}
+
+// evict removes an old peer outside of swarms with baseline providers, starting from the shard of the hash
+func (db *Memory) evict(hash storage.Hash) bool {
+	first := db.shard(hash)
+	if db.evictOldest(first) {
+		return true
+	}
+	for i := range db.shards {
+		if s := &db.shards[i]; s != first && db.evictOldest(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictOldest removes the least recently seen peer of the shard outside of swarms with baseline providers.
+// Only the oldest evictScan entries of the expiry index are considered.
+func (db *Memory) evictOldest(s *shard) bool {
+	type candidate struct {
+		expiry
+		second int64
+	}
+	candidates := make([]candidate, 0, evictScan)
+
+	now := time.Now().Unix()
+	s.expiries.mutex.Lock()
+	for second := s.expiries.next; second <= now && len(candidates) < evictScan; second++ {
+		for _, entry := range s.expiries.buckets[second] {
+			// swarm entries have no peer to evict
+			if entry.provider || entry.id == (storage.PeerID{}) {
+				continue
+			}
+			candidates = append(candidates, candidate{expiry: entry, second: second})
+			if len(candidates) == evictScan {
+				break
+			}
+		}
+	}
+	s.expiries.mutex.Unlock()
+
+	for _, c := range candidates {
+		s.mutex.RLock()
+		peermap, ok := s.hashmap[c.hash]
+		s.mutex.RUnlock()
+		if !ok {
+			continue
+		}
+
+		peermap.mutex.Lock()
+		// entries of peers that announced since are stale
+		peer, ok := peermap.Peers.get(c.id)
+		if ok && peer.LastSeen <= c.second && len(peermap.BaselineProviders) == 0 {
+			db.delete(peermap, c.id)
+			peermap.mutex.Unlock()
+			return true
+		}
+		peermap.mutex.Unlock()
+	}
+
+	return false
+}
+
+// ipPeers returns the number of peers the address holds across all swarms
+func (db *Memory) ipPeers(ip netip.Addr) uint {
+	db.ipMutex.Lock()
+	peers := db.ips[ip]
+	db.ipMutex.Unlock()
+	return peers
+}
+
+// countIP adds delta to the number of peers the address holds, it's only tracked while DB.Limits.IPSwarms is enabled
+func (db *Memory) countIP(ip netip.Addr, delta int) {
+	if config.Config.DB.Limits.IPSwarms == 0 {
+		return
+	}
+
+	db.ipMutex.Lock()
+	if peers := int(db.ips[ip]) + delta; peers > 0 {
+		db.ips[ip] = uint(peers)
+	} else {
+		delete(db.ips, ip)
+	}
+	db.ipMutex.Unlock()
+}
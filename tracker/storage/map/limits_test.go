@@ -0,0 +1,167 @@
+package gomap
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestLimits(t *testing.T) {
+	originalLimits, originalSources := config.Config.DB.Limits, config.Config.DB.TrustedSources
+	defer func() {
+		config.Config.DB.Limits = originalLimits
+		config.Config.DB.TrustedSources = originalSources
+	}()
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	config.Config.DB.Limits.Swarms = 2
+	config.Config.DB.Limits.SwarmPeers = 2
+	config.Config.DB.Limits.IPSwarms = 2
+	pools.Initialize(10)
+
+	var db Memory
+	db.make()
+
+	provided, open, extra := storage.Hash{1}, storage.Hash{2}, storage.Hash{3}
+	ip := func(i byte) netip.Addr { return netip.AddrFrom4([4]byte{10, 0, 0, i}) }
+	has := func(hash storage.Hash, id storage.PeerID) bool {
+		peermap, ok := db.peermap(hash)
+		if !ok {
+			return false
+		}
+		_, ok = peermap.Peers.get(id)
+		return ok
+	}
+
+	db.Save(ip(1), netip.Addr{}, 1000, true, false, provided, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(netip.MustParseAddr("1.2.3.4"), netip.Addr{}, 4000, true, false, provided, storage.PeerID{100}, 0, 0, 0, &storage.ProviderClaim{})
+	db.Save(ip(2), netip.Addr{}, 1000, true, false, open, storage.PeerID{2}, 0, 0, 0, nil)
+
+	// new swarms are rejected once there are enough, unless a baseline provider creates them
+	rejected := stats.RejectedSwarms.Load()
+	db.Save(ip(3), netip.Addr{}, 1000, true, false, extra, storage.PeerID{3}, 0, 0, 0, nil)
+	if _, ok := db.peermap(extra); ok || stats.RejectedSwarms.Load() != rejected+1 {
+		t.Error("swarm created over the swarm limit")
+	}
+	db.Save(netip.MustParseAddr("1.2.3.4"), netip.Addr{}, 4000, true, false, extra, storage.PeerID{100}, 0, 0, 0, &storage.ProviderClaim{})
+	if _, ok := db.peermap(extra); !ok {
+		t.Error("baseline provider swarm rejected by the swarm limit")
+	}
+
+	// full swarms reject new peers, unless they have baseline providers where the stalest peer is evicted
+	db.Save(ip(4), netip.Addr{}, 1000, true, false, open, storage.PeerID{4}, 0, 0, 0, nil)
+	rejected = stats.RejectedSwarmPeers.Load()
+	db.Save(ip(5), netip.Addr{}, 1000, true, false, open, storage.PeerID{5}, 0, 0, 0, nil)
+	if has(open, storage.PeerID{5}) || stats.RejectedSwarmPeers.Load() != rejected+1 {
+		t.Error("peer admitted to a full swarm")
+	}
+
+	peermap, _ := db.peermap(provided)
+	db.Save(ip(6), netip.Addr{}, 1000, true, false, provided, storage.PeerID{6}, 0, 0, 0, nil)
+	stale, _ := peermap.Peers.get(storage.PeerID{1})
+	stale.LastSeen -= 60
+	evicted := stats.EvictedSwarmPeers.Load()
+	db.Save(ip(7), netip.Addr{}, 1000, true, false, provided, storage.PeerID{7}, 0, 0, 0, nil)
+	if !has(provided, storage.PeerID{7}) || has(provided, storage.PeerID{1}) || stats.EvictedSwarmPeers.Load() != evicted+1 {
+		t.Error("full swarm with baseline providers didn't evict its stalest peer")
+	}
+
+	// an address can only be a peer in so many swarms, joining the full swarm evicts 7 which is made the stalest
+	stale, _ = peermap.Peers.get(storage.PeerID{7})
+	stale.LastSeen -= 30
+	db.Save(ip(9), netip.Addr{}, 1000, true, false, provided, storage.PeerID{9}, 0, 0, 0, nil)
+	db.Save(ip(9), netip.Addr{}, 1000, true, false, extra, storage.PeerID{9}, 0, 0, 0, nil)
+	rejected = stats.RejectedIPSwarms.Load()
+	db.Drop(open, storage.PeerID{4}, netip.AddrPort{})
+	db.Save(ip(9), netip.Addr{}, 1000, true, false, open, storage.PeerID{9}, 0, 0, 0, nil)
+	if has(open, storage.PeerID{9}) || stats.RejectedIPSwarms.Load() != rejected+1 {
+		t.Error("address admitted to more swarms than the limit")
+	}
+	db.Drop(extra, storage.PeerID{9}, netip.AddrPort{})
+	db.Save(ip(9), netip.Addr{}, 1000, true, false, open, storage.PeerID{9}, 0, 0, 0, nil)
+	if !has(open, storage.PeerID{9}) {
+		t.Error("address rejected after leaving a swarm")
+	}
+
+	// the peer limit evicts the oldest peer outside of swarms with baseline providers to admit peers to those that have them
+	config.Config.DB.Limits.Swarms, config.Config.DB.Limits.SwarmPeers, config.Config.DB.Limits.IPSwarms = 0, 0, 0
+	config.Config.DB.Limits.Peers = uint(db.peers.Load())
+	rejected = stats.RejectedPeers.Load()
+	db.Save(ip(10), netip.Addr{}, 1000, true, false, open, storage.PeerID{10}, 0, 0, 0, nil)
+	if has(open, storage.PeerID{10}) || stats.RejectedPeers.Load() != rejected+1 {
+		t.Error("peer admitted over the peer limit")
+	}
+	evicted = stats.EvictedPeers.Load()
+	db.Save(ip(11), netip.Addr{}, 1000, true, false, provided, storage.PeerID{11}, 0, 0, 0, nil)
+	if !has(provided, storage.PeerID{11}) || stats.EvictedPeers.Load() != evicted+1 {
+		t.Error("peer limit didn't make room in a swarm with baseline providers")
+	}
+	if has(open, storage.PeerID{2}) || !has(provided, storage.PeerID{6}) {
+		t.Error("peer limit evicted a peer other than the oldest outside of protected swarms")
+	}
+}
+
+func TestLimitsRejectedClaim(t *testing.T) {
+	originalLimits, originalSources := config.Config.DB.Limits, config.Config.DB.TrustedSources
+	defer func() {
+		config.Config.DB.Limits = originalLimits
+		config.Config.DB.TrustedSources = originalSources
+	}()
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin", Hashes: []string{"0100000000000000000000000000000000000000"}},
+	}
+	config.Config.DB.Limits.Swarms = 2
+	pools.Initialize(10)
+
+	var db Memory
+	db.make()
+
+	source := netip.MustParseAddr("1.2.3.4")
+	for i := byte(0); i < 100; i++ {
+		hash := storage.Hash{2, i}
+		db.Save(netip.AddrFrom4([4]byte{10, 0, 0, i}), netip.Addr{}, 4000, true, false, hash, storage.PeerID{i}, 0, 0, 0, &storage.ProviderClaim{}) // not a trusted source
+		db.Save(source, netip.Addr{}, 4000, true, false, hash, storage.PeerID{i}, 0, 0, 0, &storage.ProviderClaim{})                                // outside of the source scope
+	}
+	db.Save(source, netip.Addr{}, 4000, false, false, storage.Hash{1}, storage.PeerID{1}, 0, 0, 0, &storage.ProviderClaim{}) // incomplete
+
+	if hashes := db.Hashes(); hashes != 0 {
+		t.Errorf("Hashes() = %v after rejected baseline provider claims, want 0", hashes)
+	}
+}
+
+func TestLimitsConcurrentSwarms(t *testing.T) {
+	originalLimits := config.Config.DB.Limits
+	defer func() { config.Config.DB.Limits = originalLimits }()
+	config.Config.Path.Sources = ""
+	config.Config.DB.Limits.Swarms = 10
+	pools.Initialize(10)
+
+	var db Memory
+	db.make()
+
+	// announces of new hashes race for the last swarms
+	var wg sync.WaitGroup
+	for i := byte(0); i < 100; i++ {
+		wg.Add(1)
+		go func(i byte) {
+			defer wg.Done()
+			db.Save(netip.AddrFrom4([4]byte{10, 0, 0, i}), netip.Addr{}, 1000, true, false, storage.Hash{3, i}, storage.PeerID{i}, 0, 0, 0, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if hashes := db.Hashes(); hashes != 10 {
+		t.Errorf("Hashes() = %v after concurrent announces, want the limit of 10", hashes)
+	}
+	if swarms := db.swarms.Load(); swarms != 10 {
+		t.Errorf("swarms = %v after concurrent announces, want 10", swarms)
+	}
+}
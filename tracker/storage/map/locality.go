@@ -0,0 +1,57 @@
+package gomap
+
+import (
+	"math"
+	"net/netip"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// localityScan is how many candidates per handed out peer are sampled for ranking by locality
+const localityScan = 4
+
+// closeness ranks how near the peer is to the requester: 2 in the same subnet, 1 in the same network, 0 otherwise
+func (db *Memory) closeness(ip netip.Addr, network string, s *slot) int {
+	peerIP := s.ip()
+	if storage.SameSubnet(ip, peerIP) {
+		return 2
+	}
+	if network != "" && db.locality.Network(peerIP) == network {
+		return 1
+	}
+	return 0
+}
+
+// rankLocal moves the closest candidates to the front, up to a Numwant.Local share of want.
+// The other candidates keep their random order so peers still meet the rest of the swarm.
+func (db *Memory) rankLocal(candidates []*slot, ip netip.Addr, network string, want uint) {
+	local := int(math.Round(float64(want) * config.Config.Numwant.Local))
+	if local == 0 || len(candidates) == 0 {
+		return
+	}
+
+	levels := make([]int, len(candidates))
+	for i, s := range candidates {
+		levels[i] = db.closeness(ip, network, s)
+	}
+
+	ranked := make([]*slot, 0, len(candidates))
+	for level := 2; level > 0 && len(ranked) < local; level-- {
+		for i, s := range candidates {
+			if levels[i] == level {
+				ranked = append(ranked, s)
+				levels[i] = -1
+				if len(ranked) == local {
+					break
+				}
+			}
+		}
+	}
+	for i, s := range candidates {
+		if levels[i] != -1 {
+			ranked = append(ranked, s)
+		}
+	}
+	copy(candidates, ranked)
+}
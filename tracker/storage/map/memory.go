@@ -7,6 +7,7 @@ package gomap
 import (
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/crimist/trakx/tracker/config"
@@ -19,6 +20,7 @@ import (
 const (
 	hashMapPrealloc        = 250_000
 	reliableSourcePrealloc = 100
+	resolveTimeout         = 10 * time.Second
 	peerMapPrealloc        = 1
 )
 
@@ -26,21 +28,116 @@ type PeerMap struct {
 	mutex             sync.RWMutex // can't be embedded (https://github.com/golang/go/issues/5819#issuecomment-250596051)
 	Complete          uint16
 	Incomplete        uint16
-	Peers             map[storage.PeerID]*storage.Peer
-	BaselineProviders map[storage.PeerID]*storage.Peer
+	Peers             peers // pointer free so the GC doesn't scan them
+	BaselineProviders map[storage.PeerID]*Provider
+	Rates             storage.Rates // sum of the transfer rates of Peers
+	Created           int64         // unix time the swarm was first announced to
+	Snatches          uint32        // completed downloads, see Save
+}
+
+// Provider is a baseline provider and the trusted source it registered through.
+type Provider struct {
+	storage.Peer
+	Source   string
+	Capacity uint16 // advertised number of concurrent peers it can serve, 0 if not advertised
+
+	// referrals to the provider counted over fixed windows of the referral window length
+	referrals     uint32
+	prevReferrals uint32
+	windowStart   int64
+
+	referred map[storage.PeerID]int64 // peers referred to the provider and when, nil until the first referral
 }
 
 type Memory struct {
-	mutex          sync.RWMutex
-	hashmap        map[storage.Hash]*PeerMap
-	trustedSources map[storage.ReliableSource]bool
+	shards  []shard // swarms split by infohash
+	expired struct {
+		peers, baselineProviders, hashes atomic.Int64
+	} // removed by expiry since the last trim
+
+	// counted for DB.Limits
+	peers   atomic.Int64
+	swarms  atomic.Int64
+	ipMutex sync.Mutex
+	ips     map[netip.Addr]uint // peers held by each address, only tracked while DB.Limits.IPSwarms is enabled
+
+	sourceChanges  sync.Mutex                        // serialises trusted source changes with their save so a failed save can be undone
+	mutex          sync.RWMutex                      // guards the trusted sources
+	trustedSources map[string]*storage.TrustedSource // by name
+	trustedAddrs   []*storage.TrustedSource          // keyless sources
+
+	signatureMutex sync.Mutex
+	signatures     map[string]int64 // accepted baseline provider signatures and their timestamp
+
+	offenderMutex sync.RWMutex
+	offenders     map[netip.Addr]*offender // addresses detected as bad actors
+
+	reputationMutex sync.RWMutex
+	reputations     map[netip.Addr]*reputation // reputation of addresses across all swarms
+
+	reporterMutex sync.Mutex
+	reporters     map[netip.Addr]*reporter // peer addresses that recently reported misbehaviour
+
+	selector  selector              // baseline provider selection strategy
+	handout   *storage.HandoutRules // when baseline providers are handed out, nil always hands out
+	policy    namedPolicy           // active bad actor detection policy
+	shadows   []namedPolicy         // bad actor detection policies that are never enforced
+	decisions *zap.Logger           // behavior policy decision log, nil if disabled
+	locality  *storage.Locality     // networks of addresses peer lists are ranked by, nil if none
 
 	backup storage.Backup
+
+	stop    chan struct{}  // closed to stop the background work started by Init
+	workers sync.WaitGroup // background work started by Init
 }
 
 func (db *Memory) Init(backup storage.Backup) error {
+	// the database may be initialized again, the work of the previous one must be done before it is replaced
+	db.stopWorkers()
+
+	selection := config.Config.Baseline.Selection
+	if selection == "" {
+		selection = config.BaselineSelectionRandom
+	}
+	selector, ok := selectors[selection]
+	if !ok {
+		return errors.New("invalid baseline selection strategy '" + selection + "'")
+	}
+
+	switch config.Config.Numwant.Offenders {
+	case config.OffendersLast, config.OffendersOmit, config.OffendersAny:
+	default:
+		return errors.New("invalid numwant offenders placement '" + config.Config.Numwant.Offenders + "'")
+	}
+
+	handout, err := storage.ParseHandoutRules(config.Config.Baseline.Handout, config.Config.Baseline.Torrents)
+	if err != nil {
+		return errors.Wrap(err, "invalid baseline handout rules")
+	}
+
+	policy, shadows, decisions, err := loadPolicies()
+	if err != nil {
+		return errors.Wrap(err, "failed to load behavior policies")
+	}
+
+	locality, err := storage.LoadLocality(config.Config.Path.Locality)
+	if err != nil {
+		return errors.Wrap(err, "failed to load locality data")
+	}
+
+	// the sources are loaded again with the database, fail here rather than running without them
+	if _, err := storage.LoadTrustedSources(); err != nil {
+		return errors.Wrap(err, "failed to load trusted sources")
+	}
+
 	*db = Memory{
-		backup: backup,
+		selector:  selector,
+		handout:   handout,
+		policy:    policy,
+		shadows:   shadows,
+		decisions: decisions,
+		locality:  locality,
+		backup:    backup,
 	}
 
 	if err := db.backup.Init(db); err != nil {
@@ -50,41 +147,72 @@ func (db *Memory) Init(backup storage.Backup) error {
 		return errors.Wrap(err, "failed to load backup")
 	}
 
+	db.resolveSources()
+	db.stop = make(chan struct{})
+	db.runOn(config.Config.DB.Resolve, db.resolveSources)
+
 	if config.Config.DB.Backup.Frequency > 0 {
-		go utils.RunOn(config.Config.DB.Backup.Frequency, func() {
+		db.runOn(config.Config.DB.Backup.Frequency, func() {
 			if err := db.backup.Save(); err != nil {
 				config.Logger.Info("Failed to backup the database", zap.Error(err))
 			}
 		})
 	}
+	db.runOn(expireInterval, func() {
+		db.expire(time.Now())
+	})
+	// the replay cache grows with every signed announce, it can't wait for trims which may be disabled
+	if config.Config.DB.SignatureWindow > 0 {
+		db.runOn(config.Config.DB.SignatureWindow, func() {
+			db.trimSignatures()
+		})
+	}
 	if config.Config.DB.Trim > 0 {
-		go utils.RunOn(config.Config.DB.Trim, db.Trim)
+		db.runOn(config.Config.DB.Trim, db.Trim)
 	}
 
 	return nil
 }
 
-func (db *Memory) make() {
-	db.hashmap = make(map[storage.Hash]*PeerMap, hashMapPrealloc)
-	// reliable sources information is available from config
-	db.trustedSources = make(map[storage.ReliableSource]bool, reliableSourcePrealloc)
-	for _, rawAddr := range config.Config.DB.TrustedSources {
-		ip, err := netip.ParseAddr(rawAddr.IP)
-		if err != nil {
-			continue
-		}
-		addr := storage.ReliableSource{IP: ip, Port: rawAddr.Port}
-		db.trustedSources[addr] = true
+// runOn runs the function on every tick of the duration in the background until stopWorkers
+func (db *Memory) runOn(duration time.Duration, run func()) {
+	db.workers.Add(1)
+	go func() {
+		defer db.workers.Done()
+		utils.RunOnUntil(duration, db.stop, run)
+	}()
+}
+
+// stopWorkers stops the background work started by Init and waits for it to return
+func (db *Memory) stopWorkers() {
+	if db.stop == nil {
+		return
 	}
+	close(db.stop)
+	db.workers.Wait()
+	db.stop = nil
 }
 
-func (db *Memory) makePeermap(h storage.Hash) (peermap *PeerMap) {
-	// build struct and assign
-	peermap = new(PeerMap)
-	peermap.Peers = make(map[storage.PeerID]*storage.Peer, peerMapPrealloc)
-	peermap.BaselineProviders = make(map[storage.PeerID]*storage.Peer, peerMapPrealloc)
-	db.hashmap[h] = peermap
-	return
+// make resets the database, backups are loaded through it before Init starts the background work
+func (db *Memory) make() {
+	db.makeShards(config.Config.DB.Shards)
+	db.peers.Store(0)
+	db.swarms.Store(0)
+	db.ips = make(map[netip.Addr]uint)
+	db.signatures = make(map[string]int64)
+	db.offenders = make(map[netip.Addr]*offender)
+	db.reputations = make(map[netip.Addr]*reputation)
+	db.reporters = make(map[netip.Addr]*reporter)
+	// reliable sources information is available from the sources file or config
+	db.trustedSources = make(map[string]*storage.TrustedSource, reliableSourcePrealloc)
+	db.trustedAddrs = make([]*storage.TrustedSource, 0, reliableSourcePrealloc)
+	sources, err := storage.LoadTrustedSources()
+	if err != nil {
+		config.Logger.Error("Failed to load trusted sources", zap.Error(err))
+	}
+	for _, source := range sources {
+		db.addSource(source)
+	}
 }
 
 func (db *Memory) Backup() storage.Backup {
@@ -92,49 +220,17 @@ func (db *Memory) Backup() storage.Backup {
 }
 
 func (db *Memory) Check() bool {
-	return db.hashmap != nil
+	return db.shards != nil
 }
 
 func (db *Memory) Trim() {
 	start := time.Now()
 	config.Logger.Info("Trimming database")
-	peers, baselineProviders, hashes := db.trim()
-	config.Logger.Info("Trimmed database", zap.Int("peers", peers), zap.Int("baselineProviders", baselineProviders), zap.Int("hashes", hashes), zap.Duration("duration", time.Since(start)))
-}
-
-func (db *Memory) trim() (peers, baselineProviders, hashes int) {
-	now := time.Now().Unix()
-	peerTimeout := int64(config.Config.DB.Expiry.Seconds())
-
-	db.mutex.RLock()
-	for hash, peermap := range db.hashmap {
-		db.mutex.RUnlock()
-
-		peermap.mutex.Lock()
-		for id, peer := range peermap.Peers {
-			if now-peer.LastSeen > peerTimeout {
-				db.delete(peer, peermap, id, false)
-				peers++
-			}
-		}
-		for id, baselineProvider := range peermap.BaselineProviders {
-			if baselineProvider.LastSeen > peerTimeout {
-				db.delete(baselineProvider, peermap, id, true)
-				baselineProviders++
-			}
-		}
-		peersize := len(peermap.Peers)
-		peermap.mutex.Unlock()
-
-		if peersize == 0 {
-			db.mutex.Lock()
-			delete(db.hashmap, hash)
-			db.mutex.Unlock()
-			hashes++
-		}
-		db.mutex.RLock()
-	}
-	db.mutex.RUnlock()
-
-	return
+	// peers are removed continuously as they expire, report what was removed since the last trim
+	peers, baselineProviders, hashes := db.expired.peers.Swap(0), db.expired.baselineProviders.Swap(0), db.expired.hashes.Swap(0)
+	signatures := db.trimSignatures()
+	offenders := db.trimOffenders()
+	reputations := db.trimReputations()
+	reporters := db.trimReporters()
+	config.Logger.Info("Trimmed database", zap.Int64("peers", peers), zap.Int64("baselineProviders", baselineProviders), zap.Int64("hashes", hashes), zap.Int("signatures", signatures), zap.Int("offenders", offenders), zap.Int("reputations", reputations), zap.Int("reporters", reporters), zap.Duration("duration", time.Since(start)))
 }
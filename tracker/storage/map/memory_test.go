@@ -20,17 +20,64 @@ func TestCheck(t *testing.T) {
 	}
 }
 
-func TestTrim(t *testing.T) {
+func TestInitAgain(t *testing.T) {
+	config.Config.Path.Sources = ""
+
+	var db Memory
+	if err := db.Init(&NoneBackup{}); err != nil {
+		t.Fatal("Init() failed", err)
+	}
+	first := db.stop
+	if err := db.Init(&NoneBackup{}); err != nil {
+		t.Fatal("Init() failed", err)
+	}
+	defer db.stopWorkers()
+
+	select {
+	case <-first:
+	default:
+		t.Error("Init() left the background work of the previous database running")
+	}
+}
+
+func TestTrimSignaturesWithoutTrim(t *testing.T) {
+	config.Config.Path.Sources = ""
+	defer func(trim, window time.Duration) {
+		config.Config.DB.Trim, config.Config.DB.SignatureWindow = trim, window
+	}(config.Config.DB.Trim, config.Config.DB.SignatureWindow)
+	config.Config.DB.Trim = 0
+	config.Config.DB.SignatureWindow = time.Second
+
+	var db Memory
+	if err := db.Init(&NoneBackup{}); err != nil {
+		t.Fatal("Init() failed", err)
+	}
+	defer db.stopWorkers()
+
+	db.signatureMutex.Lock()
+	db.signatures["stale"] = time.Now().Unix() - 10
+	db.signatureMutex.Unlock()
+
+	time.Sleep(2100 * time.Millisecond)
+	db.signatureMutex.Lock()
+	_, ok := db.signatures["stale"]
+	db.signatureMutex.Unlock()
+	if ok {
+		t.Error("signature outside the window kept with trims disabled")
+	}
+}
+
+func TestExpireAll(t *testing.T) {
 	config.Config.DB.Expiry = 0
 
 	db := dbWithHashes(150_000)
-	db.trim()
+	db.expire(time.Now())
 
 	db, _ = dbWithPeers(200_000)
-	db.trim()
+	db.expire(time.Now())
 }
 
-func BenchmarkTrim(b *testing.B) {
+func BenchmarkExpireAll(b *testing.B) {
 	config.Config.DB.Expiry = -1 * time.Second
 
 	b.StopTimer()
@@ -40,7 +87,7 @@ func BenchmarkTrim(b *testing.B) {
 		peerdb := dbWithHashesAndPeers(benchHashes, benchPeers)
 
 		b.StartTimer()
-		peerdb.trim()
+		peerdb.expire(time.Now())
 		b.StopTimer()
 	}
 }
@@ -1,42 +1,37 @@
 package gomap
 
 import (
+	"encoding/hex"
+	"math"
 	"net/netip"
 	"time"
 
-	"github.com/crimist/trakx/pools"
 	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/stats"
 	"github.com/crimist/trakx/tracker/storage"
+	"go.uber.org/zap"
 )
 
 // Save saves either a peer or a baseline provider to db, if applicable
+// A non nil claim marks the announce as coming from a baseline provider
+// Peers over the DB.Limits aren't stored but aren't bad actors either
+// alt is the address of the other family of a dual-stack peer, without one the last known address of the other family is kept
+// so peers announcing over each family in turn (BEP 15) are known by both
+// completed is true if the announce carried the completed event, it counts as a snatch of the hash unless the peer was already complete
 // Return false if:
-// - peer is a "bad actor", in which case some limits might apply
+// - peer is a "bad actor", in which case the offence is recorded against its address and penalties apply
 // - baseline provider is a "fraud", in which case it is not stored to the db
-func (memoryDb *Memory) Save(ip netip.Addr, port uint16, complete bool, hash storage.Hash, id storage.PeerID, uploaded int64, downloaded int64, baselineProvider bool) (isBad bool) {
-	// get/create the map
-	memoryDb.mutex.RLock()
-	peermap, ok := memoryDb.hashmap[hash]
-	memoryDb.mutex.RUnlock()
-
-	// if submap doesn't exist create it
-	if !ok {
-		memoryDb.mutex.Lock()
-		peermap = memoryDb.makePeermap(hash)
-		memoryDb.mutex.Unlock()
-	}
-
+func (memoryDb *Memory) Save(ip netip.Addr, alt netip.Addr, port uint16, complete bool, completed bool, hash storage.Hash, id storage.PeerID, uploaded int64, downloaded int64, left int64, claim *storage.ProviderClaim) (goodActing bool) {
 	// if saving a baseline provider
-	if baselineProvider {
-		// first check against the trusted sources
-		memoryDb.mutex.RLock()
-		currentSource := storage.ReliableSource{IP: ip, Port: port}
-		_, ok = memoryDb.trustedSources[currentSource]
-		memoryDb.mutex.RUnlock()
-
-		// if it is unknown, we found a "fraud"
-		if !ok {
+	if claim != nil {
+		// first authenticate against the trusted sources, if it fails we found a "fraud"
+		source := memoryDb.authenticate(ip, port, claim, storage.SignedMessage(hash, id, port, complete, uploaded, downloaded, left, claim.Event, claim.NumBaseline, claim.Capacity, claim.Timestamp))
+		if source == nil {
+			return false
+		}
+		// a trusted source may only provide the torrents it is scoped to
+		if !memoryDb.inScope(source, hash) {
+			config.Logger.Warn("Rejected baseline provider outside of its source scope", zap.String("source", source.Name), zap.String("hash", hex.EncodeToString(hash[:])), zap.Stringer("ip", ip))
 			return false
 		}
 
@@ -46,19 +41,32 @@ func (memoryDb *Memory) Save(ip netip.Addr, port uint16, complete bool, hash sto
 			// However, it will always be considered as a good actor thus maximum allowed peer list will be provided
 			return true
 		}
+		// authenticated baseline providers are admitted regardless of the limits
+		peermap, _ := memoryDb.loadPeermap(hash, false)
 		peermap.mutex.RLock()
 		bp, bpExists := peermap.BaselineProviders[id]
 		peermap.mutex.RUnlock()
 
 		peermap.mutex.Lock()
+		if !memoryDb.trusts(source, hash) {
+			peermap.mutex.Unlock()
+			return false
+		}
 		// if baseline provider does not exist then create
 		if !bpExists {
-			bp = pools.Peers.Get()
+			bp = new(Provider)
 			peermap.BaselineProviders[id] = bp
 			bp.IP = ip
 			bp.Port = port
 		}
+		now := time.Now().Unix()
+		bp.Source = source.Name
+		bp.Capacity = claim.Capacity // 0 if not advertised
+		bp.LastSeen = now
+		// referrals are trimmed as the provider announces rather than by walking every swarm
+		bp.trimReferred(now)
 		peermap.mutex.Unlock()
+		memoryDb.shard(hash).schedule(hash, id, now, true)
 
 		// update metrics
 		if !fast && !bpExists {
@@ -67,21 +75,65 @@ func (memoryDb *Memory) Save(ip netip.Addr, port uint16, complete bool, hash sto
 			stats.IPStats.Unlock()
 		}
 
-		bp.LastSeen = time.Now().Unix()
 		// baseline provider is never a bad actor
 		return true
 	}
 
+	// get/create the map
+	peermap, swarmExists := memoryDb.peermap(hash)
+	if !swarmExists {
+		if !memoryDb.admit(hash, nil, ip) {
+			return true
+		}
+		var ok bool
+		if peermap, ok = memoryDb.loadPeermap(hash, true); !ok {
+			return true
+		}
+	}
+
+	// an address of the same family adds nothing
+	if alt.IsValid() && alt.Is4() == ip.Is4() {
+		alt = netip.Addr{}
+	}
+
 	// get peer
 	peermap.mutex.RLock()
-	peer, peerExists := peermap.Peers[id]
+	_, peerExists := peermap.Peers.get(id)
 	peermap.mutex.RUnlock()
 
+	// new swarms were admitted with their first peer
+	if !peerExists && swarmExists && !memoryDb.admit(hash, peermap, ip) {
+		return true
+	}
+
+	// the peer is copied out of its slot, slots move as peers come and go
+	var peer storage.Peer
 	peermap.mutex.Lock()
+	s, peerExists := peermap.Peers.get(id)
 	// if peer does not exist then create
 	if !peerExists {
-		peer = pools.Peers.Get()
-		peermap.Peers[id] = peer
+		s = peermap.Peers.add(id)
+		s.set(&storage.Peer{Complete: complete, IP: ip, AltIP: alt, Port: port, LastSeen: time.Now().Unix()})
+		memoryDb.peers.Add(1)
+		memoryDb.countIP(ip, 1)
+	} else {
+		peer = s.peer()
+		if peer.IP != ip {
+			memoryDb.countIP(peer.IP, -1)
+			memoryDb.countIP(ip, 1)
+		}
+		if !alt.IsValid() {
+			if peer.IP.Is4() != ip.Is4() {
+				alt = peer.IP
+			} else {
+				alt = peer.AltIP
+			}
+		}
+	}
+
+	// repeated completed events of a seed are the same download
+	if completed && (!peerExists || !peer.Complete) && peermap.Snatches < math.MaxUint32 {
+		peermap.Snatches++
 	}
 
 	// update peermap completion counts
@@ -134,118 +186,143 @@ func (memoryDb *Memory) Save(ip netip.Addr, port uint16, complete bool, hash sto
 		}
 	}
 
-	// now to identify bad actors - we will adopt a very simple design (that does not necessarily work 100%)
-	// a peer is "bad" if:
-	// it is not yet incomplete
-	// it uploads nothing, but downloads something
-	// there have been multiple leechers in the swarm since the last time this records is made
-	if !complete && peer.Uploaded == uploaded && peer.Downloaded < downloaded && peer.LeechersLastTime >= config.Config.Behavior.MinLeechers {
-		isBad = true
+	// build the state to save and judge it against the previous one with the behavior policy
+	current := storage.Peer{
+		Complete:         complete,
+		IP:               ip,
+		AltIP:            alt,
+		Port:             port,
+		LastSeen:         time.Now().Unix(),
+		Uploaded:         uploaded,
+		Downloaded:       downloaded,
+		LeechersLastTime: peermap.Incomplete,
+		Left:             left,
+	}
+	var previous *storage.Peer
+	if peerExists {
+		previous = &peer
+		if current.Uploaded < peer.Uploaded {
+			current.Uploaded = peer.Uploaded
+		}
+		if current.Downloaded < peer.Downloaded {
+			current.Downloaded = peer.Downloaded
+		}
+		current.WindowStart = peer.WindowStart
+		current.WindowUploaded = peer.WindowUploaded
+		current.WindowDownloaded = peer.WindowDownloaded
+		// leechers whose left didn't decrease are stalled
+		if !complete && left > 0 && peer.Left > 0 && left >= peer.Left && peer.Stalled < math.MaxUint16 {
+			current.Stalled = peer.Stalled + 1
+		}
+	}
+	current.MeasureRates(previous)
+
+	// the swarm is judged with the current rates of the peer in place of its previous ones
+	var previousRates storage.Rates
+	if previous != nil {
+		previousRates = storage.Rates{Upload: previous.UploadRate, Download: previous.DownloadRate}
+	}
+	peermap.mutex.RLock()
+	swarm := storage.Swarm{Complete: peermap.Complete, Incomplete: peermap.Incomplete, Rates: peermap.Rates}
+	peermap.mutex.RUnlock()
+	swarm.Rates.Upload += current.UploadRate - previousRates.Upload
+	swarm.Rates.Download += current.DownloadRate - previousRates.Download
+
+	goodActing = !memoryDb.judge(hash, id, previous, &current, swarm)
+	if !goodActing {
+		memoryDb.offend(ip)
+	}
+	// seeds that keep uploading build up reputation
+	if previous != nil && current.Complete && current.Uploaded > previous.Uploaded {
+		memoryDb.addReputation(ip, config.Config.Reputation.Seeding)
 	}
 
-	// update peer
-	peer.Complete = complete
-	peer.IP = ip
-	peer.Port = port
-	peer.LastSeen = time.Now().Unix()
-	if peer.Uploaded < uploaded {
-		peer.Uploaded = uploaded
+	// update peer and swap its stored rates for the current ones in the swarm sum, unless it was dropped in the meantime
+	var uploadDelta, downloadDelta int64
+	peermap.mutex.Lock()
+	s, peerExists = peermap.Peers.get(id)
+	if peerExists {
+		uploadDelta, downloadDelta = current.UploadRate-s.UploadRate, current.DownloadRate-s.DownloadRate
+		peermap.Rates.Upload += uploadDelta
+		peermap.Rates.Download += downloadDelta
+		s.set(&current)
 	}
-	if peer.Downloaded < downloaded {
-		peer.Downloaded = downloaded
+	peermap.mutex.Unlock()
+
+	if !fast {
+		stats.UploadRate.Add(uploadDelta)
+		stats.DownloadRate.Add(downloadDelta)
 	}
-	peer.LeechersLastTime = peermap.Incomplete
+	memoryDb.shard(hash).schedule(hash, id, current.LastSeen, false)
 	return
 }
 
 // delete is similar to drop but doesn't lock
-func (db *Memory) delete(peer *storage.Peer, peermap *PeerMap, id storage.PeerID, baselineProvider bool) {
-	if baselineProvider {
-		delete(peermap.BaselineProviders, id)
-	} else {
-		delete(peermap.Peers, id)
+func (db *Memory) delete(peermap *PeerMap, id storage.PeerID) {
+	s, ok := peermap.Peers.get(id)
+	if !ok {
+		return
+	}
+	complete, ip, uploadRate, downloadRate := s.Complete, s.ip(), s.UploadRate, s.DownloadRate
+	peermap.Peers.remove(id)
+	db.peers.Add(-1)
+	db.countIP(ip, -1)
 
-		if peer.Complete {
-			peermap.Complete--
-		} else {
-			peermap.Incomplete--
-		}
+	if complete {
+		peermap.Complete--
+	} else {
+		peermap.Incomplete--
 	}
+	peermap.Rates.Upload -= uploadRate
+	peermap.Rates.Download -= downloadRate
 
 	if !fast {
-		if !baselineProvider {
-			if peer.Complete {
-				stats.Seeds.Add(-1)
-			} else {
-				stats.Leeches.Add(-1)
-			}
+		if complete {
+			stats.Seeds.Add(-1)
+		} else {
+			stats.Leeches.Add(-1)
 		}
+		stats.UploadRate.Add(-uploadRate)
+		stats.DownloadRate.Add(-downloadRate)
 
 		stats.IPStats.Lock()
-		stats.IPStats.Remove(peer.IP)
+		stats.IPStats.Remove(ip)
 		stats.IPStats.Unlock()
 	}
+}
 
-	pools.Peers.Put(peer)
+// deleteProvider is similar to drop for baseline providers but doesn't lock
+func (db *Memory) deleteProvider(provider *Provider, peermap *PeerMap, id storage.PeerID) {
+	delete(peermap.BaselineProviders, id)
+
+	if !fast {
+		stats.IPStats.Lock()
+		stats.IPStats.Remove(provider.IP)
+		stats.IPStats.Unlock()
+	}
 }
 
 // Drop deletes peer or baseline provider
-func (db *Memory) Drop(hash storage.Hash, id storage.PeerID, baselineProvider bool) {
+// A valid provider address drops the baseline provider, only if it registered from that address so others can't stop it
+func (db *Memory) Drop(hash storage.Hash, id storage.PeerID, provider netip.AddrPort) {
 	// get the peermap
-	db.mutex.RLock()
-	peermap, ok := db.hashmap[hash]
-	db.mutex.RUnlock()
+	peermap, ok := db.peermap(hash)
 	if !ok {
 		return
 	}
 
 	peermap.mutex.Lock()
 	// get the baseline provider and remove it
-	if baselineProvider {
-		peer, ok := peermap.BaselineProviders[id]
-		if !ok {
-			peermap.mutex.Unlock()
-			return
-		}
-
-		if !fast {
-			stats.IPStats.Lock()
-			stats.IPStats.Remove(peer.IP)
-			stats.IPStats.Unlock()
+	if provider.IsValid() {
+		bp, ok := peermap.BaselineProviders[id]
+		if ok && bp.IP == provider.Addr() && bp.Port == provider.Port() {
+			db.deleteProvider(bp, peermap, id)
 		}
 		peermap.mutex.Unlock()
-		// free the peer back to the pool
-		pools.Peers.Put(peer)
 		return
 	}
 
 	// get the peer and remove it
-	peer, ok := peermap.Peers[id]
-	if !ok {
-		peermap.mutex.Unlock()
-		return
-	}
-	delete(peermap.Peers, id)
-
-	if peer.Complete {
-		peermap.Complete--
-	} else {
-		peermap.Incomplete--
-	}
+	db.delete(peermap, id)
 	peermap.mutex.Unlock()
-
-	if !fast {
-		if peer.Complete {
-			stats.Seeds.Add(-1)
-		} else {
-			stats.Leeches.Add(-1)
-		}
-
-		stats.IPStats.Lock()
-		stats.IPStats.Remove(peer.IP)
-		stats.IPStats.Unlock()
-	}
-
-	// free the peer back to the pool
-	pools.Peers.Put(peer)
 }
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/storage"
 )
 
@@ -21,12 +23,14 @@ func TestSaveDrop(t *testing.T) {
 	db.make()
 
 	peerWrite := storage.Peer{
-		Complete: true,
-		IP:       testIP,
-		Port:     4321,
+		Complete:   true,
+		IP:         testIP,
+		Port:       4321,
+		Uploaded:   testUploaded,
+		Downloaded: testDownloaded,
 	}
-	db.Save(peerWrite.IP, peerWrite.Port, peerWrite.Complete, testHash, testId, testUploaded, testDownloaded, false)
-	peerRead, ok := db.hashmap[testHash].Peers[testId]
+	db.Save(peerWrite.IP, netip.Addr{}, peerWrite.Port, peerWrite.Complete, false, testHash, testId, peerWrite.Uploaded, peerWrite.Downloaded, 0, nil)
+	peerRead, ok := db.shard(testHash).hashmap[testHash].Peers.get(testId)
 
 	if !ok {
 		t.Error("Failed to read peer from database map")
@@ -34,8 +38,8 @@ func TestSaveDrop(t *testing.T) {
 	if peerRead.Complete != peerWrite.Complete {
 		t.Errorf("Peer complete not equal %v:%v", peerRead.Complete, peerWrite.Complete)
 	}
-	if peerRead.IP != peerWrite.IP {
-		t.Errorf("Peer IP not equal %v:%v", peerRead.IP, peerWrite.IP)
+	if peerRead.ip() != peerWrite.IP {
+		t.Errorf("Peer IP not equal %v:%v", peerRead.ip(), peerWrite.IP)
 	}
 	if peerRead.Port != peerWrite.Port {
 		t.Errorf("Peer port not equal %v:%v", peerRead.Port, peerWrite.Port)
@@ -44,23 +48,142 @@ func TestSaveDrop(t *testing.T) {
 		t.Errorf("Peer LastSeen not correct %v:%v", peerRead.LastSeen, time.Now().Unix())
 	}
 	if peerRead.Uploaded != peerWrite.Uploaded {
-		t.Errorf("Peer Uploaded not equal %v:%v", peerRead.IP, peerWrite.IP)
+		t.Errorf("Peer Uploaded not equal %v:%v", peerRead.Uploaded, peerWrite.Uploaded)
 	}
 	if peerRead.Downloaded != peerWrite.Downloaded {
-		t.Errorf("Peer Downloaded not equal %v:%v", peerRead.Port, peerWrite.Port)
+		t.Errorf("Peer Downloaded not equal %v:%v", peerRead.Downloaded, peerWrite.Downloaded)
 	}
 
-	db.Drop(testHash, testId, false)
-	_, ok = db.hashmap[testHash].Peers[testId]
+	db.Drop(testHash, testId, netip.AddrPort{})
+	_, ok = db.shard(testHash).hashmap[testHash].Peers.get(testId)
 
 	if ok {
 		t.Error("Failed top drop peer from database")
 	}
 }
 
+func TestSaveBadActor(t *testing.T) {
+	original := config.Config.Behavior
+	defer func() { config.Config.Behavior = original }()
+	config.Config.Behavior.MinLeechers = 0
+	config.Config.Behavior.Penalty.BanOffences = 2
+	config.Config.Behavior.Penalty.BanDuration = time.Minute
+	config.Config.Behavior.Penalty.Forget = time.Hour
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	if !db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 100, 0, nil) {
+		t.Fatal("first announce flagged as bad acting")
+	}
+	if penalty := db.Penalty(testIP); penalty.Offences != 0 {
+		t.Fatalf("Penalty() = %+v, want good standing", penalty)
+	}
+
+	// downloading without uploading
+	for offences := uint(1); offences <= 2; offences++ {
+		if db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 100+int64(offences), 0, nil) {
+			t.Fatal("free riding not flagged as bad acting")
+		}
+		if penalty := db.Penalty(testIP); penalty.Offences != offences {
+			t.Fatalf("Penalty().Offences = %v, want %v", penalty.Offences, offences)
+		}
+	}
+
+	if penalty := db.Penalty(testIP); !penalty.Banned(time.Now().Unix()) {
+		t.Errorf("Penalty() = %+v, want banned after %v offences", penalty, config.Config.Behavior.Penalty.BanOffences)
+	}
+	if penalty := db.Penalty(netip.MustParseAddr("4.3.2.1")); penalty.Offences != 0 {
+		t.Errorf("Penalty() of another address = %+v, want good standing", penalty)
+	}
+	if db.trimOffenders() != 0 {
+		t.Error("trimOffenders() forgave a recent offender")
+	}
+}
+
+func TestSaveDualStack(t *testing.T) {
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	ip6 := netip.MustParseAddr("2001:db8::1")
+	requester := storage.Requester{ID: storage.PeerID{1}}
+
+	db.Save(testIP, ip6, 4321, false, false, testHash, testId, 0, 0, 0, nil)
+	peer, ok := db.shard(testHash).hashmap[testHash].Peers.get(testId)
+	if !ok {
+		t.Fatal("Failed to read peer from database map")
+	}
+	if got := peer.peer().AltIP; got != ip6 {
+		t.Errorf("AltIP = %v, want %v", got, ip6)
+	}
+
+	peers4, peers6 := db.PeerListBytes(testHash, requester, 10)
+	if len(peers4) != 6 || len(peers6) != 18 {
+		t.Errorf("PeerListBytes() returned %d and %d bytes, want the peer in both lists", len(peers4), len(peers6))
+	}
+
+	// BEP 15 clients announce over each family in turn without naming the other
+	db.Save(ip6, netip.Addr{}, 4321, false, false, testHash, testId, 0, 0, 0, nil)
+	peer, _ = db.shard(testHash).hashmap[testHash].Peers.get(testId)
+	if got := peer.peer(); got.IP != ip6 || got.AltIP != testIP {
+		t.Errorf("announce over IPv6 stored %v and %v, want %v and %v", got.IP, got.AltIP, ip6, testIP)
+	}
+	db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 0, 0, nil)
+	peer, _ = db.shard(testHash).hashmap[testHash].Peers.get(testId)
+	if got := peer.peer(); got.IP != testIP || got.AltIP != ip6 {
+		t.Errorf("announce over IPv4 stored %v and %v, want %v and %v", got.IP, got.AltIP, testIP, ip6)
+	}
+
+	// an alt of the announce's own family isn't another stack
+	other := storage.PeerID{2}
+	db.Save(testIP, netip.MustParseAddr("5.6.7.8"), 4321, false, false, testHash, other, 0, 0, 0, nil)
+	peer, _ = db.shard(testHash).hashmap[testHash].Peers.get(other)
+	if got := peer.peer().AltIP; got.IsValid() {
+		t.Errorf("AltIP = %v, want none", got)
+	}
+}
+
+func TestDropProvider(t *testing.T) {
+	originalSources := config.Config.DB.TrustedSources
+	defer func() { config.Config.DB.TrustedSources = originalSources }()
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	source := netip.MustParseAddr("1.2.3.4")
+	if !db.Save(source, netip.Addr{}, 4000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}) {
+		t.Fatal("Save() rejected the baseline provider")
+	}
+	registered := func() bool {
+		peermap, _ := db.peermap(testHash)
+		_, ok := peermap.BaselineProviders[testId]
+		return ok
+	}
+
+	// the peer id of providers is handed out, knowing it isn't enough to stop them
+	db.Drop(testHash, testId, netip.AddrPortFrom(netip.MustParseAddr("5.6.7.8"), 4000))
+	db.Drop(testHash, testId, netip.AddrPortFrom(source, 4001))
+	db.Drop(testHash, testId, netip.AddrPort{})
+	if !registered() {
+		t.Fatal("Drop() stopped a baseline provider from another address")
+	}
+
+	db.Drop(testHash, testId, netip.AddrPortFrom(source, 4000))
+	if registered() {
+		t.Error("Drop() didn't stop the baseline provider from its own address")
+	}
+}
+
 func benchmarkSave(b *testing.B, db *Memory, peer storage.Peer, hash storage.Hash, peerid storage.PeerID) {
 	for n := 0; n < b.N; n++ {
-		db.Save(peer.IP, peer.Port, peer.Complete, hash, peerid, peer.Uploaded, peer.Downloaded, false)
+		db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
 	}
 }
 
@@ -86,7 +209,7 @@ func BenchmarkSave(b *testing.B) {
 
 func benchmarkDrop(b *testing.B, db *Memory, hash storage.Hash, peerid storage.PeerID) {
 	for n := 0; n < b.N; n++ {
-		db.Drop(hash, peerid, false)
+		db.Drop(hash, peerid, netip.AddrPort{})
 	}
 }
 
@@ -104,8 +227,8 @@ func BenchmarkDrop(b *testing.B) {
 
 func benchmarkSaveDrop(b *testing.B, db *Memory, peer storage.Peer, hash storage.Hash, peerid storage.PeerID) {
 	for n := 0; n < b.N; n++ {
-		db.Save(peer.IP, peer.Port, peer.Complete, hash, peerid, peer.Uploaded, peer.Downloaded, false)
-		db.Drop(hash, peerid, false)
+		db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
+		db.Drop(hash, peerid, netip.AddrPort{})
 	}
 }
 
@@ -145,8 +268,8 @@ func benchmarkSaveDropParallel(b *testing.B, routines int) {
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			db.Save(peer.IP, peer.Port, peer.Complete, hash, peerid, peer.Uploaded, peer.Downloaded, false)
-			db.Drop(hash, peerid, false)
+			db.Save(peer.IP, netip.Addr{}, peer.Port, peer.Complete, false, hash, peerid, peer.Uploaded, peer.Downloaded, 0, nil)
+			db.Drop(hash, peerid, netip.AddrPort{})
 		}
 	})
 }
@@ -157,3 +280,39 @@ func BenchmarkSaveDropParallel64(b *testing.B)  { benchmarkSaveDropParallel(b, 6
 func BenchmarkSaveDropParallel128(b *testing.B) { benchmarkSaveDropParallel(b, 128) }
 func BenchmarkSaveDropParallel256(b *testing.B) { benchmarkSaveDropParallel(b, 256) }
 func BenchmarkSaveDropParallel512(b *testing.B) { benchmarkSaveDropParallel(b, 512) }
+
+func TestSaveRates(t *testing.T) {
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	otherId := storage.PeerID{1}
+	db.Save(testIP, netip.Addr{}, 4321, true, false, testHash, testId, 0, 0, 0, nil)
+	db.Save(testIP, netip.Addr{}, 4322, true, false, testHash, otherId, 0, 0, 0, nil)
+
+	// pretend the last announces were 10 seconds ago
+	db.shard(testHash).hashmap[testHash].Peers.each(func(peer *slot) bool {
+		peer.LastSeen -= 10
+		return true
+	})
+	db.Save(testIP, netip.Addr{}, 4321, true, false, testHash, testId, 1000, 0, 0, nil)
+	db.Save(testIP, netip.Addr{}, 4322, true, false, testHash, otherId, 500, 200, 0, nil)
+
+	swarm, peers := db.Rates(testHash)
+	if swarm.Upload != 150 || swarm.Download != 20 {
+		t.Errorf("swarm rates = %+v, want 150/20", swarm)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("len(peers) = %v, want 2", len(peers))
+	}
+	for _, peer := range peers {
+		if peer.ID == testId && (peer.Upload != 100 || peer.Download != 0) {
+			t.Errorf("peer rates = %+v, want 100/0", peer.Rates)
+		}
+	}
+
+	db.Drop(testHash, otherId, netip.AddrPort{})
+	if swarm, _ := db.Rates(testHash); swarm.Upload != 100 || swarm.Download != 0 {
+		t.Errorf("swarm rates after drop = %+v, want 100/0", swarm)
+	}
+}
@@ -0,0 +1,88 @@
+package gomap
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// offender is the record of an address detected as a bad actor
+type offender struct {
+	offences    uint
+	lastOffence int64
+	bannedUntil int64
+}
+
+// forgiven returns true if the offender hasn't offended recently and isn't banned
+func (o *offender) forgiven(now int64) bool {
+	return now-o.lastOffence > int64(config.Config.Behavior.Penalty.Forget.Seconds()) && o.bannedUntil <= now
+}
+
+// offend records an offence by the address, escalating to a ban if warranted
+func (db *Memory) offend(ip netip.Addr) {
+	now := time.Now().Unix()
+
+	db.offenderMutex.Lock()
+	o, ok := db.offenders[ip]
+	if !ok {
+		o = new(offender)
+		db.offenders[ip] = o
+	} else if o.forgiven(now) {
+		*o = offender{}
+	}
+	o.offences++
+	o.lastOffence = now
+
+	banned := false
+	if duration := storage.BanDuration(o.offences); duration > 0 {
+		o.bannedUntil = now + int64(duration.Seconds())
+		banned = true
+	}
+	db.offenderMutex.Unlock()
+
+	db.addReputation(ip, -config.Config.Reputation.Detection)
+
+	stats.Offences.Add(1)
+	if banned {
+		stats.Bans.Add(1)
+	}
+}
+
+// Penalty returns the standing of the address, without offences if it hasn't offended recently
+func (db *Memory) Penalty(ip netip.Addr) (penalty storage.Penalty) {
+	db.offenderMutex.RLock()
+	o, ok := db.offenders[ip]
+	if ok && !o.forgiven(time.Now().Unix()) {
+		penalty.Offences = o.offences
+		penalty.BannedUntil = o.bannedUntil
+	}
+	db.offenderMutex.RUnlock()
+
+	penalty.Reputation = db.reputation(ip)
+	return
+}
+
+// offending returns true if the address has unforgiven offences, the caller must hold the offender read lock
+func (db *Memory) offending(ip netip.Addr, now int64) bool {
+	o, ok := db.offenders[ip]
+	return ok && !o.forgiven(now)
+}
+
+// trimOffenders forgets offenders that haven't offended recently
+func (db *Memory) trimOffenders() (offenders int) {
+	now := time.Now().Unix()
+
+	db.offenderMutex.Lock()
+	for ip, o := range db.offenders {
+		if o.forgiven(now) {
+			delete(db.offenders, ip)
+			offenders++
+		}
+	}
+	db.offenderMutex.Unlock()
+
+	return
+}
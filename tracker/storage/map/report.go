@@ -0,0 +1,131 @@
+package gomap
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+	"go.uber.org/zap"
+)
+
+// reporter counts the reports of a peer address within the current report window
+type reporter struct {
+	reports     uint
+	windowStart int64
+}
+
+// Report records a report of a misbehaving peer.
+// A non nil claim marks the report as coming from a trusted source, it is authenticated like an announce and counts as an offence.
+// Other reports must come from a peer in the swarm, they're rate limited and only cost the reported address reputation.
+func (db *Memory) Report(ip netip.Addr, report *storage.Report, claim *storage.ProviderClaim) (err error) {
+	defer func() {
+		if err != nil {
+			stats.ReportsRejected.Add(1)
+		}
+	}()
+
+	if !report.Type.Valid() {
+		return storage.ErrReportType
+	}
+
+	trusted := claim != nil
+	if trusted {
+		source := db.authenticate(ip, report.Port, claim, report.Message(claim.Timestamp))
+		if source == nil || !db.inScope(source, report.Hash) {
+			return storage.ErrUntrustedProvider
+		}
+	} else if !config.Config.Report.Peers {
+		return storage.ErrReportsClosed
+	}
+
+	peermap, ok := db.peermap(report.Hash)
+	if !ok {
+		return storage.ErrReportTarget
+	}
+
+	var target netip.Addr
+	peermap.mutex.RLock()
+	if !trusted {
+		if s, ok := peermap.Peers.get(report.Reporter); !ok || s.ip() != ip {
+			peermap.mutex.RUnlock()
+			return storage.ErrReporter
+		}
+	}
+	if s, ok := peermap.Peers.get(report.Target); ok {
+		target = s.ip()
+	} else if report.Endpoint.IsValid() {
+		// dual-stack peers are reported by either address, offences still go to the one they announce from
+		endpoint := report.Endpoint.Addr().Unmap()
+		peermap.Peers.each(func(s *slot) bool {
+			if (s.ip() == endpoint || s.alt() == endpoint) && s.Port == report.Endpoint.Port() {
+				target = s.ip()
+				return false
+			}
+			return true
+		})
+	}
+	peermap.mutex.RUnlock()
+
+	if !target.IsValid() {
+		return storage.ErrReportTarget
+	}
+
+	if trusted {
+		db.offend(target)
+		stats.SourceReports.Add(1)
+	} else {
+		if !db.allowReport(ip) {
+			return storage.ErrReportLimit
+		}
+		db.addReputation(target, -config.Config.Report.PeerWeight)
+		stats.PeerReports.Add(1)
+	}
+
+	config.Logger.Debug("Peer reported", zap.Stringer("type", report.Type), zap.Bool("trusted", trusted), zap.String("hash", hex.EncodeToString(report.Hash[:])), zap.Stringer("target", target), zap.Stringer("reporter", ip))
+	return nil
+}
+
+// allowReport counts a report from the peer address, returning false if it exceeds Report.PeerLimit
+func (db *Memory) allowReport(ip netip.Addr) bool {
+	limit := config.Config.Report.PeerLimit
+	if limit == 0 {
+		return true
+	}
+	now := time.Now().Unix()
+
+	db.reporterMutex.Lock()
+	defer db.reporterMutex.Unlock()
+
+	r, ok := db.reporters[ip]
+	if !ok {
+		r = &reporter{windowStart: now}
+		db.reporters[ip] = r
+	} else if now-r.windowStart >= int64(config.Config.Report.PeerWindow.Seconds()) {
+		*r = reporter{windowStart: now}
+	}
+	if r.reports >= limit {
+		return false
+	}
+	r.reports++
+
+	return true
+}
+
+// trimReporters forgets reporters whose report window has passed
+func (db *Memory) trimReporters() (reporters int) {
+	oldest := time.Now().Unix() - int64(config.Config.Report.PeerWindow.Seconds())
+
+	db.reporterMutex.Lock()
+	for ip, r := range db.reporters {
+		if r.windowStart <= oldest {
+			delete(db.reporters, ip)
+			reporters++
+		}
+	}
+	db.reporterMutex.Unlock()
+
+	return
+}
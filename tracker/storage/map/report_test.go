@@ -0,0 +1,87 @@
+package gomap
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestReport(t *testing.T) {
+	originalReport, originalReputation, originalBehavior := config.Config.Report, config.Config.Reputation, config.Config.Behavior
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	defer func() {
+		config.Config.Report, config.Config.Reputation, config.Config.Behavior = originalReport, originalReputation, originalBehavior
+		config.Config.DB.TrustedSources = nil
+	}()
+	config.Config.Report.Peers = true
+	config.Config.Report.PeerLimit = 1
+	config.Config.Report.PeerWindow = time.Hour
+	config.Config.Report.PeerWeight = 2
+	config.Config.Reputation.HalfLife = time.Hour
+	config.Config.Reputation.Max = 100
+	config.Config.Reputation.Detection = 10
+	config.Config.Behavior.Penalty.Forget = time.Hour
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	reporter, target := storage.PeerID{1}, storage.PeerID{2}
+	reporterIP, targetIP := netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")
+	db.Save(reporterIP, netip.Addr{}, 5000, false, false, testHash, reporter, 0, 0, 100, nil)
+	targetAlt := netip.MustParseAddr("2001:db8::2")
+	db.Save(targetIP, targetAlt, 5000, false, false, testHash, target, 0, 0, 100, nil)
+
+	// peer reports cost reputation and are rate limited
+	report := storage.Report{Hash: testHash, Reporter: reporter, Port: 5000, Type: storage.ReportCorrupt, Target: target}
+	if err := db.Report(reporterIP, &report, nil); err != nil {
+		t.Fatal("Report() threw error:", err)
+	}
+	if penalty := db.Penalty(targetIP); penalty.Offences != 0 || penalty.Reputation >= 0 {
+		t.Errorf("Penalty() after a peer report = %+v, want lower reputation without offences", penalty)
+	}
+	if err := db.Report(reporterIP, &report, nil); !errors.Is(err, storage.ErrReportLimit) {
+		t.Errorf("second Report() = %v, want %v", err, storage.ErrReportLimit)
+	}
+
+	// peers must report from their own address in the swarm
+	if err := db.Report(targetIP, &report, nil); !errors.Is(err, storage.ErrReporter) {
+		t.Errorf("Report() from another address = %v, want %v", err, storage.ErrReporter)
+	}
+
+	// trusted source reports by endpoint count as offences
+	byEndpoint := storage.Report{Hash: testHash, Port: 4000, Type: storage.ReportNoUpload, Endpoint: netip.AddrPortFrom(targetIP, 5000)}
+	if err := db.Report(testIP, &byEndpoint, &storage.ProviderClaim{}); err != nil {
+		t.Fatal("trusted Report() threw error:", err)
+	}
+	if penalty := db.Penalty(targetIP); penalty.Offences != 1 {
+		t.Errorf("Penalty().Offences after a trusted report = %v, want 1", penalty.Offences)
+	}
+	if err := db.Report(reporterIP, &byEndpoint, &storage.ProviderClaim{}); !errors.Is(err, storage.ErrUntrustedProvider) {
+		t.Errorf("trusted Report() from an untrusted address = %v, want %v", err, storage.ErrUntrustedProvider)
+	}
+
+	// endpoints match either address of dual-stack peers and IPv4-mapped addresses match IPv4 peers
+	for i, endpoint := range []netip.Addr{targetAlt, netip.MustParseAddr("::ffff:10.0.0.2")} {
+		byEndpoint.Endpoint = netip.AddrPortFrom(endpoint, 5000)
+		if err := db.Report(testIP, &byEndpoint, &storage.ProviderClaim{}); err != nil {
+			t.Fatalf("trusted Report() of %v threw error: %v", endpoint, err)
+		}
+		if penalty := db.Penalty(targetIP); penalty.Offences != uint(i+2) {
+			t.Errorf("Penalty().Offences after a report of %v = %v, want %v", endpoint, penalty.Offences, i+2)
+		}
+	}
+
+	byEndpoint.Endpoint = netip.AddrPortFrom(targetIP, 5001)
+	if err := db.Report(testIP, &byEndpoint, &storage.ProviderClaim{}); !errors.Is(err, storage.ErrReportTarget) {
+		t.Errorf("Report() of an unknown endpoint = %v, want %v", err, storage.ErrReportTarget)
+	}
+}
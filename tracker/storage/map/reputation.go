@@ -0,0 +1,68 @@
+package gomap
+
+import (
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// minReputation is the magnitude below which a decayed reputation is forgotten
+const minReputation = 0.01
+
+// reputation is the reputation score of an address across all swarms
+type reputation struct {
+	score   float64
+	updated int64 // unix time the score was last decayed
+}
+
+// current returns the score decayed to the unix time now
+func (r *reputation) current(now int64) float64 {
+	return storage.DecayReputation(r.score, now-r.updated)
+}
+
+// addReputation decays the reputation of the address and adds delta to it
+func (db *Memory) addReputation(ip netip.Addr, delta float64) {
+	if delta == 0 {
+		return
+	}
+	now := time.Now().Unix()
+
+	db.reputationMutex.Lock()
+	r, ok := db.reputations[ip]
+	if !ok {
+		r = &reputation{updated: now}
+		db.reputations[ip] = r
+	}
+	r.score = storage.AddReputation(r.current(now), delta)
+	r.updated = now
+	db.reputationMutex.Unlock()
+}
+
+// reputation returns the decayed reputation of the address, 0 if it has none
+func (db *Memory) reputation(ip netip.Addr) (score float64) {
+	db.reputationMutex.RLock()
+	if r, ok := db.reputations[ip]; ok {
+		score = r.current(time.Now().Unix())
+	}
+	db.reputationMutex.RUnlock()
+
+	return
+}
+
+// trimReputations forgets reputations that have decayed to nothing
+func (db *Memory) trimReputations() (reputations int) {
+	now := time.Now().Unix()
+
+	db.reputationMutex.Lock()
+	for ip, r := range db.reputations {
+		if math.Abs(r.current(now)) < minReputation {
+			delete(db.reputations, ip)
+			reputations++
+		}
+	}
+	db.reputationMutex.Unlock()
+
+	return
+}
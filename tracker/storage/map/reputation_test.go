@@ -0,0 +1,148 @@
+package gomap
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestReputation(t *testing.T) {
+	originalReputation, originalBehavior := config.Config.Reputation, config.Config.Behavior
+	defer func() {
+		config.Config.Reputation = originalReputation
+		config.Config.Behavior = originalBehavior
+	}()
+	config.Config.Reputation.HalfLife = time.Hour
+	config.Config.Reputation.Seeding = 1
+	config.Config.Reputation.Detection = 10
+	config.Config.Reputation.Max = 100
+	config.Config.Reputation.BaselineMin = -5
+	config.Config.Behavior.MinLeechers = 0
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	// seeding in one swarm builds reputation
+	seed := netip.MustParseAddr("1.1.1.1")
+	db.Save(seed, netip.Addr{}, 1000, true, false, testHash, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(seed, netip.Addr{}, 1000, true, false, testHash, storage.PeerID{1}, 10, 0, 0, nil)
+	if score := db.Penalty(seed).Reputation; score != 1 {
+		t.Errorf("seed reputation = %v, want 1", score)
+	}
+
+	// free riding in one swarm carries over to the others
+	leech := netip.MustParseAddr("2.2.2.2")
+	db.Save(leech, netip.Addr{}, 1000, false, false, testHash, storage.PeerID{2}, 0, 10, 0, nil)
+	db.Save(leech, netip.Addr{}, 1000, false, false, testHash, storage.PeerID{2}, 0, 20, 0, nil)
+	penalty := db.Penalty(leech)
+	if penalty.Reputation != -10 {
+		t.Errorf("leech reputation = %v, want -10", penalty.Reputation)
+	}
+	if !penalty.WithholdBaseline() {
+		t.Error("baseline providers not withheld below the minimum reputation")
+	}
+	if numwant := (storage.Penalty{Reputation: penalty.Reputation}).Numwant(50); numwant != 45 {
+		t.Errorf("Numwant(50) = %v, want 45", numwant)
+	}
+
+	// disreputable peers are placed last
+	db.Save(seed, netip.Addr{}, 1000, true, false, storage.Hash{1}, storage.PeerID{1}, 0, 0, 0, nil)
+	db.Save(leech, netip.Addr{}, 1000, false, false, storage.Hash{1}, storage.PeerID{2}, 0, 0, 0, nil)
+	for i := 0; i < 10; i++ {
+		peers4, peers6 := db.PeerListBytes(storage.Hash{1}, storage.Requester{}, 1)
+		if len(peers4) != 6 || !bytes.Equal(peers4[:4], seed.AsSlice()) {
+			t.Fatalf("PeerListBytes() = %v, want only the seed", peers4)
+		}
+		pools.Peerlists4.Put(peers4)
+		pools.Peerlists6.Put(peers6)
+	}
+
+	// reputation decays by half every half life
+	db.reputations[leech].updated -= 3600
+	if score := db.reputation(leech); score != -5 {
+		t.Errorf("decayed reputation = %v, want -5", score)
+	}
+	db.reputations[leech].updated -= 3600 * 20
+	if db.trimReputations() != 1 {
+		t.Error("trimReputations() didn't forget a decayed reputation")
+	}
+}
+
+func TestPeerListShaping(t *testing.T) {
+	originalNumwant, originalReputation := config.Config.Numwant, config.Config.Reputation
+	defer func() {
+		config.Config.Numwant = originalNumwant
+		config.Config.Reputation = originalReputation
+	}()
+	config.Config.Numwant.Seeds = 0.5
+	config.Config.Numwant.Local = 0
+	config.Config.Reputation.Max = 100
+	config.Config.Reputation.BaselineMin = -50
+
+	var db Memory
+	db.make()
+
+	// peers 1 and 2 are seeds, 3 to 5 leechers and 5 an offender
+	for i := byte(1); i <= 5; i++ {
+		db.Save(netip.AddrFrom4([4]byte{10, 0, 0, i}), netip.Addr{}, 1000, i <= 2, false, testHash, storage.PeerID{i}, 0, 0, 0, nil)
+	}
+	offender := netip.AddrFrom4([4]byte{10, 0, 0, 5})
+	db.offend(offender)
+	peermap, _ := db.peermap(testHash)
+
+	good := storage.Requester{ID: storage.PeerID{9}}
+	bad := storage.Requester{ID: storage.PeerID{9}, Penalty: db.Penalty(offender)}
+	has := func(picked []*slot, id storage.PeerID) bool {
+		for _, s := range picked {
+			if s.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	config.Config.Numwant.Offenders = config.OffendersLast
+	for i := 0; i < 20; i++ {
+		if picked := db.pick(peermap, good, 5); len(picked) != 5 || picked[4].ID != (storage.PeerID{5}) {
+			t.Fatal("offender not placed last for a good actor")
+		}
+	}
+
+	config.Config.Numwant.Offenders = config.OffendersOmit
+	omitted := stats.PeerListsOmitted.Load()
+	if picked := db.pick(peermap, good, 5); len(picked) != 4 || has(picked, storage.PeerID{5}) || stats.PeerListsOmitted.Load() != omitted+1 {
+		t.Error("offender not left out for a good actor")
+	}
+	if picked := db.pick(peermap, bad, 5); !has(picked, storage.PeerID{5}) {
+		t.Error("offender left out for a bad actor")
+	}
+
+	// reputable leechers get more seeds
+	seeds := func(requester storage.Requester) (seeds int) {
+		for _, s := range db.pick(peermap, requester, 2) {
+			if s.Complete {
+				seeds++
+			}
+		}
+		return
+	}
+	config.Config.Numwant.Reputable = 0.5
+	if n := seeds(good); n != 1 {
+		t.Errorf("leecher without reputation got %v of 2 seeds, want 1", n)
+	}
+	good.Penalty.Reputation = 100
+	if n := seeds(good); n != 2 {
+		t.Errorf("reputable leecher got %v of 2 seeds, want 2", n)
+	}
+	bad.Penalty.Reputation = 100
+	if n := seeds(bad); n != 1 {
+		t.Errorf("reputable bad actor got %v of 2 seeds, want 1", n)
+	}
+}
@@ -0,0 +1,105 @@
+package gomap
+
+import (
+	"math/rand"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// selector picks one of the given baseline providers, providers is never empty
+type selector func(providers []*Provider, now int64) *Provider
+
+var selectors = map[string]selector{
+	config.BaselineSelectionRandom:      selectRandom,
+	config.BaselineSelectionLeastLoaded: selectLeastLoaded,
+	config.BaselineSelectionWeighted:    selectWeighted,
+}
+
+// load returns the number of peers referred to the provider within the last referral window.
+// Referrals are counted in fixed windows, the previous window is weighted by how much of it still overlaps the sliding window.
+func (provider *Provider) load(now int64) float64 {
+	window := int64(config.Config.Baseline.ReferralWindow.Seconds())
+	if window <= 0 {
+		return float64(provider.referrals)
+	}
+
+	elapsed := now - provider.windowStart
+	switch {
+	case elapsed >= 2*window:
+		return 0
+	case elapsed >= window:
+		return float64(provider.referrals) * float64(2*window-elapsed) / float64(window)
+	}
+
+	return float64(provider.prevReferrals)*float64(window-elapsed)/float64(window) + float64(provider.referrals)
+}
+
+// refer records that the peer was referred to the provider, the caller must hold the peermap write lock
+func (provider *Provider) refer(id storage.PeerID, now int64) {
+	if provider.referred == nil {
+		provider.referred = make(map[storage.PeerID]int64)
+	}
+	provider.referred[id] = now
+
+	window := int64(config.Config.Baseline.ReferralWindow.Seconds())
+
+	if window > 0 && now-provider.windowStart >= window {
+		if now-provider.windowStart >= 2*window {
+			provider.prevReferrals = 0
+		} else {
+			provider.prevReferrals = provider.referrals
+		}
+		provider.referrals = 0
+		provider.windowStart = now - (now-provider.windowStart)%window
+	}
+
+	provider.referrals++
+}
+
+// capacity returns the advertised capacity of the provider or the configured default
+func (provider *Provider) capacity() float64 {
+	if provider.Capacity == 0 {
+		return float64(config.Config.Baseline.DefaultCapacity)
+	}
+	return float64(provider.Capacity)
+}
+
+func selectRandom(providers []*Provider, now int64) *Provider {
+	return providers[rand.Intn(len(providers))]
+}
+
+func selectLeastLoaded(providers []*Provider, now int64) *Provider {
+	// start at a random offset so ties are broken randomly
+	offset := rand.Intn(len(providers))
+	least := providers[offset]
+	leastLoad := least.load(now)
+
+	for i := 1; i < len(providers); i++ {
+		provider := providers[(offset+i)%len(providers)]
+		if load := provider.load(now); load < leastLoad {
+			least, leastLoad = provider, load
+		}
+	}
+
+	return least
+}
+
+func selectWeighted(providers []*Provider, now int64) *Provider {
+	weights := make([]float64, len(providers))
+	var total float64
+	for i, provider := range providers {
+		weights[i] = provider.capacity() / (1 + provider.load(now))
+		total += weights[i]
+	}
+
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return providers[i]
+		}
+		pick -= weight
+	}
+
+	return providers[len(providers)-1]
+}
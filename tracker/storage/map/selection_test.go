@@ -0,0 +1,103 @@
+package gomap
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestProviderLoad(t *testing.T) {
+	config.Config.Baseline.ReferralWindow = 10 * time.Second
+
+	var provider Provider
+	for i := 0; i < 4; i++ {
+		provider.refer(testId, 100)
+	}
+
+	cases := []struct {
+		name string
+		now  int64
+		load float64
+	}{
+		{"current", 105, 4},
+		{"halfExpired", 115, 2},
+		{"expired", 120, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if load := provider.load(c.now); load != c.load {
+				t.Errorf("load(%v) = %v, want %v", c.now, load, c.load)
+			}
+		})
+	}
+
+	// rolling into the next window keeps half of the previous one at its midpoint
+	provider.refer(testId, 110)
+	if load := provider.load(115); load != 3 {
+		t.Errorf("load after roll = %v, want 3", load)
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	config.Config.Baseline.ReferralWindow = 10 * time.Second
+	config.Config.Baseline.DefaultCapacity = 1
+
+	idle := &Provider{}
+	busy := &Provider{}
+	for i := 0; i < 10; i++ {
+		busy.refer(testId, 100)
+	}
+
+	for i := 0; i < 100; i++ {
+		if selectLeastLoaded([]*Provider{busy, idle}, 100) != idle {
+			t.Fatal("selectLeastLoaded() picked the busy provider")
+		}
+	}
+
+	// a large provider under the same load as a small one should get almost all referrals
+	large := &Provider{Capacity: 1000}
+	small := &Provider{Capacity: 1}
+	var picks int
+	for i := 0; i < 1000; i++ {
+		if selectWeighted([]*Provider{small, large}, 100) == large {
+			picks++
+		}
+	}
+	if picks < 950 {
+		t.Errorf("selectWeighted() picked the large provider %v/1000 times", picks)
+	}
+}
+
+func TestSaveProviderCapacity(t *testing.T) {
+	originalSources := config.Config.DB.TrustedSources
+	defer func() { config.Config.DB.TrustedSources = originalSources }()
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	capacity := func() uint16 {
+		peermap, _ := db.peermap(testHash)
+		return peermap.BaselineProviders[testId].Capacity
+	}
+
+	db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{Capacity: 8})
+	if got := capacity(); got != 8 {
+		t.Errorf("Capacity = %v after advertising 8, want 8", got)
+	}
+
+	// providers that stop advertising fall back to the default capacity
+	db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{})
+	if got := capacity(); got != 0 {
+		t.Errorf("Capacity = %v after no longer advertising, want 0", got)
+	}
+}
@@ -0,0 +1,125 @@
+package gomap
+
+import (
+	"encoding/hex"
+	"os"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// namedPolicy is a behavior policy and the name it is configured by
+type namedPolicy struct {
+	name     string
+	policy   storage.BehaviorPolicy
+	verdicts *stats.PolicyVerdicts // only for shadow policies
+}
+
+// loadPolicies resolves the active and shadow behavior policies and opens the decision log
+func loadPolicies() (active namedPolicy, shadows []namedPolicy, decisions *zap.Logger, err error) {
+	active.name = config.Config.Behavior.Policy
+	if active.policy, err = storage.GetPolicy(active.name); err != nil {
+		return
+	}
+
+	for _, name := range config.Config.Behavior.Shadow {
+		shadow := namedPolicy{name: name, verdicts: stats.ShadowVerdicts(name)}
+		if shadow.policy, err = storage.GetPolicy(name); err != nil {
+			return
+		}
+		shadows = append(shadows, shadow)
+	}
+
+	if config.Config.Path.Decisions != "" {
+		file, ferr := os.OpenFile(config.Config.Path.Decisions, os.O_CREATE|os.O_APPEND|os.O_WRONLY, config.FilePerm)
+		if ferr != nil {
+			err = errors.Wrap(ferr, "failed to open decision log")
+			return
+		}
+		decisions = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.Lock(file), zap.InfoLevel))
+	}
+
+	return
+}
+
+// judge returns true if the announce is bad acting according to the active policy.
+// Shadow policies judge copies of the same state, their verdicts are counted and logged but never enforced.
+// Window bookkeeping of a shadow policy is kept if the active policy doesn't keep any.
+func (db *Memory) judge(hash storage.Hash, id storage.PeerID, previous *storage.Peer, current *storage.Peer, swarm storage.Swarm) bool {
+	active := db.policy
+	if active.policy == nil {
+		active = namedPolicy{name: config.BehaviorPolicyFreeRider, policy: storage.FreeRiderPolicy{}}
+	}
+
+	if len(db.shadows) == 0 && db.decisions == nil {
+		return active.policy.BadActor(previous, current, swarm)
+	}
+
+	input := *current
+	bad := active.policy.BadActor(previous, current, swarm)
+	windowKept := !sameWindow(&input, current)
+
+	shadowVerdicts := make(map[string]bool, len(db.shadows))
+	for _, shadow := range db.shadows {
+		var shadowPrevious *storage.Peer
+		if previous != nil {
+			previousCopy := *previous
+			shadowPrevious = &previousCopy
+		}
+		shadowCurrent := input
+
+		shadowBad := shadow.policy.BadActor(shadowPrevious, &shadowCurrent, swarm)
+		shadowVerdicts[shadow.name] = shadowBad
+
+		if shadowBad == bad {
+			shadow.verdicts.Agree.Add(1)
+		} else {
+			shadow.verdicts.Disagree.Add(1)
+		}
+		if shadowBad {
+			shadow.verdicts.Flagged.Add(1)
+		}
+
+		if !windowKept && !sameWindow(&input, &shadowCurrent) {
+			current.WindowStart = shadowCurrent.WindowStart
+			current.WindowUploaded = shadowCurrent.WindowUploaded
+			current.WindowDownloaded = shadowCurrent.WindowDownloaded
+			windowKept = true
+		}
+	}
+
+	if db.decisions != nil {
+		fields := []zap.Field{
+			zap.String("hash", hex.EncodeToString(hash[:])),
+			zap.String("peerid", hex.EncodeToString(id[:])),
+			zap.Bool("new", previous == nil),
+			zap.Bool("complete", input.Complete),
+			zap.Int64("uploaded", input.Uploaded),
+			zap.Int64("downloaded", input.Downloaded),
+			zap.Uint16("swarmComplete", swarm.Complete),
+			zap.Uint16("swarmIncomplete", swarm.Incomplete),
+			zap.String("policy", active.name),
+			zap.Bool("bad", bad),
+			zap.Any("shadow", shadowVerdicts),
+		}
+		if previous != nil {
+			fields = append(fields,
+				zap.Int64("previousUploaded", previous.Uploaded),
+				zap.Int64("previousDownloaded", previous.Downloaded),
+				zap.Int64("previousLastSeen", previous.LastSeen),
+				zap.Uint16("previousLeechers", previous.LeechersLastTime),
+			)
+		}
+		db.decisions.Info("decision", fields...)
+	}
+
+	return bad
+}
+
+func sameWindow(a, b *storage.Peer) bool {
+	return a.WindowStart == b.WindowStart && a.WindowUploaded == b.WindowUploaded && a.WindowDownloaded == b.WindowDownloaded
+}
@@ -0,0 +1,77 @@
+package gomap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestShadowPolicies(t *testing.T) {
+	original := config.Config.Behavior
+	defer func() {
+		config.Config.Behavior = original
+		config.Config.Path.Decisions = ""
+	}()
+	config.Config.Behavior.Policy = config.BehaviorPolicyFreeRider
+	config.Config.Behavior.Shadow = []string{config.BehaviorPolicyRatio}
+	config.Config.Behavior.MinLeechers = 0
+	config.Config.Behavior.Ratio.Min = 0.5
+	config.Config.Behavior.Ratio.MinDownloaded = 0
+	config.Config.Path.Decisions = filepath.Join(t.TempDir(), "decisions.log")
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	var err error
+	if db.policy, db.shadows, db.decisions, err = loadPolicies(); err != nil {
+		t.Fatal("loadPolicies() threw error:", err)
+	}
+	verdicts := db.shadows[0].verdicts
+	agree, disagree, flagged := verdicts.Agree.Load(), verdicts.Disagree.Load(), verdicts.Flagged.Load()
+
+	db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 0, 100, 0, nil)
+	// uploading so the free rider policy approves but the ratio is too low
+	if !db.Save(testIP, netip.Addr{}, 4321, false, false, testHash, testId, 10, 200, 0, nil) {
+		t.Error("shadow policy verdict was enforced")
+	}
+	db.decisions.Sync()
+
+	if delta := verdicts.Agree.Load() - agree; delta != 1 {
+		t.Errorf("agree += %v, want 1", delta)
+	}
+	if delta := verdicts.Disagree.Load() - disagree; delta != 1 {
+		t.Errorf("disagree += %v, want 1", delta)
+	}
+	if delta := verdicts.Flagged.Load() - flagged; delta != 1 {
+		t.Errorf("flagged += %v, want 1", delta)
+	}
+
+	data, err := os.ReadFile(config.Config.Path.Decisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("decision log has %v lines, want 2", len(lines))
+	}
+
+	var decision struct {
+		Policy   string
+		Bad      bool
+		Shadow   map[string]bool
+		Uploaded int64
+	}
+	if err := json.Unmarshal(lines[1], &decision); err != nil {
+		t.Fatal("failed to decode decision:", err)
+	}
+	if decision.Policy != config.BehaviorPolicyFreeRider || decision.Bad || !decision.Shadow[config.BehaviorPolicyRatio] || decision.Uploaded != 10 {
+		t.Errorf("decision = %+v", decision)
+	}
+}
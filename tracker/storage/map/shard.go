@@ -0,0 +1,95 @@
+package gomap
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// shard holds the swarms of a subset of the infohashes behind its own lock
+type shard struct {
+	mutex   sync.RWMutex
+	hashmap map[storage.Hash]*PeerMap
+
+	expiries expiries // peers and baseline providers of the shard by when they were last seen
+}
+
+// makePeermap creates the swarm of the hash, the caller must hold the write lock
+func (s *shard) makePeermap(h storage.Hash) (peermap *PeerMap) {
+	// build struct and assign
+	peermap = new(PeerMap)
+	peermap.Peers = makePeers(peerMapPrealloc)
+	peermap.BaselineProviders = make(map[storage.PeerID]*Provider, peerMapPrealloc)
+	peermap.Created = time.Now().Unix()
+	s.hashmap[h] = peermap
+	return
+}
+
+// makeShards splits the hashmap into count shards
+func (db *Memory) makeShards(count int) {
+	if count < 1 {
+		count = 1
+	}
+
+	prealloc := hashMapPrealloc
+	if limit := int(config.Config.DB.Limits.Swarms); limit > 0 && limit < prealloc {
+		prealloc = limit
+	}
+
+	now := time.Now().Unix()
+	db.shards = make([]shard, count)
+	for i := range db.shards {
+		db.shards[i].hashmap = make(map[storage.Hash]*PeerMap, prealloc/count)
+		db.shards[i].expiries.buckets = make(map[int64][]expiry)
+		db.shards[i].expiries.next = now
+	}
+}
+
+// shard returns the shard holding the hash
+func (db *Memory) shard(hash storage.Hash) *shard {
+	// infohashes are digests, their leading bytes are evenly distributed
+	return &db.shards[binary.LittleEndian.Uint32(hash[:4])%uint32(len(db.shards))]
+}
+
+// peermap returns the swarm of the hash
+func (db *Memory) peermap(hash storage.Hash) (peermap *PeerMap, ok bool) {
+	s := db.shard(hash)
+	s.mutex.RLock()
+	peermap, ok = s.hashmap[hash]
+	s.mutex.RUnlock()
+	return
+}
+
+// loadPeermap returns the swarm of the hash, creating it if it doesn't exist.
+// Limited swarms are only created within DB.Limits.Swarms, ok is false if the limit kept the swarm from being created.
+func (db *Memory) loadPeermap(hash storage.Hash, limited bool) (peermap *PeerMap, ok bool) {
+	s := db.shard(hash)
+	s.mutex.RLock()
+	peermap, ok = s.hashmap[hash]
+	s.mutex.RUnlock()
+	if ok {
+		return peermap, true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// another announce may have created it since the read lock was released
+	if peermap, ok = s.hashmap[hash]; ok {
+		return peermap, true
+	}
+	// the swarm is counted as it's created so concurrent announces of new hashes can't exceed the limit
+	if limited && !db.countSwarm() {
+		return nil, false
+	}
+	if !limited {
+		db.swarms.Add(1)
+	}
+	peermap = s.makePeermap(hash)
+	// swarms never joined are removed once their entry comes due
+	s.schedule(hash, storage.PeerID{}, peermap.Created, false)
+
+	return peermap, true
+}
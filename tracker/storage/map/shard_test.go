@@ -0,0 +1,120 @@
+package gomap
+
+import (
+	"crypto/rand"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestShards(t *testing.T) {
+	originalShards, originalExpiry := config.Config.DB.Shards, config.Config.DB.Expiry
+	defer func() {
+		config.Config.DB.Shards = originalShards
+		config.Config.DB.Expiry = originalExpiry
+	}()
+	config.Config.DB.Shards = 8
+	pools.Initialize(10)
+
+	db := dbWithHashes(1000)
+	if len(db.shards) != 8 {
+		t.Fatalf("len(shards) = %v, want 8", len(db.shards))
+	}
+	if hashes := db.Hashes(); hashes != 1000 {
+		t.Errorf("Hashes() = %v, want 1000", hashes)
+	}
+	for i := range db.shards {
+		if len(db.shards[i].hashmap) == 0 {
+			t.Errorf("shard %v is empty", i)
+		}
+		for hash := range db.shards[i].hashmap {
+			if db.shard(hash) != &db.shards[i] {
+				t.Fatalf("hash %x stored in shard %v, belongs to another", hash, i)
+			}
+		}
+	}
+
+	// backups don't depend on the number of shards
+	data, err := db.encodeBinary()
+	if err != nil {
+		t.Fatal("encodeBinary threw error: ", err)
+	}
+	config.Config.DB.Shards = 3
+	var restored Memory
+	if _, _, hashes, err := restored.decodeBinary(data); err != nil || hashes != 1000 {
+		t.Fatalf("decodeBinary() = %v hashes, %v, want 1000 hashes", hashes, err)
+	}
+	if len(restored.shards) != 3 || restored.Hashes() != 1000 {
+		t.Errorf("restored %v hashes into %v shards, want 1000 into 3", restored.Hashes(), len(restored.shards))
+	}
+
+	config.Config.DB.Expiry = -1 * time.Second
+	if _, _, hashes := db.expire(time.Now()); hashes != 1000 || db.Hashes() != 0 {
+		t.Errorf("trim() removed %v hashes leaving %v, want all 1000", hashes, db.Hashes())
+	}
+}
+
+func benchmarkSaveSharded(b *testing.B, shards int) {
+	originalShards := config.Config.DB.Shards
+	defer func() { config.Config.DB.Shards = originalShards }()
+	config.Config.DB.Shards = shards
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	// announces are spread over many swarms, a fraction of which are new
+	hashes := make([]storage.Hash, 1<<16)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var peerid storage.PeerID
+		rand.Read(peerid[:])
+
+		for i := 0; pb.Next(); i++ {
+			hash := hashes[(int(peerid[0])<<8+i)%len(hashes)]
+			db.Save(testIP, netip.Addr{}, 4321, true, false, hash, peerid, 0, 0, 0, nil)
+			peers4, peers6 := db.PeerListBytes(hash, storage.Requester{}, 50)
+			pools.Peerlists4.Put(peers4)
+			pools.Peerlists6.Put(peers6)
+		}
+	})
+}
+
+func BenchmarkSaveSharded1(b *testing.B)   { benchmarkSaveSharded(b, 1) }
+func BenchmarkSaveSharded16(b *testing.B)  { benchmarkSaveSharded(b, 16) }
+func BenchmarkSaveSharded64(b *testing.B)  { benchmarkSaveSharded(b, 64) }
+func BenchmarkSaveSharded256(b *testing.B) { benchmarkSaveSharded(b, 256) }
+
+func benchmarkExpireSharded(b *testing.B, shards int) {
+	originalShards, originalExpiry := config.Config.DB.Shards, config.Config.DB.Expiry
+	defer func() {
+		config.Config.DB.Shards = originalShards
+		config.Config.DB.Expiry = originalExpiry
+	}()
+	config.Config.DB.Shards = shards
+	config.Config.DB.Expiry = -1 * time.Second
+	pools.Initialize(10)
+
+	b.StopTimer()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		peerdb := dbWithHashesAndPeers(benchHashes/10, benchPeers)
+
+		b.StartTimer()
+		peerdb.expire(time.Now())
+		b.StopTimer()
+	}
+}
+
+func BenchmarkExpireSharded1(b *testing.B)  { benchmarkExpireSharded(b, 1) }
+func BenchmarkExpireSharded64(b *testing.B) { benchmarkExpireSharded(b, 64) }
@@ -0,0 +1,210 @@
+package gomap
+
+import (
+	"math/rand"
+	"net/netip"
+
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// slot is a peer in the form swarms store it in. It holds no pointers, netip.Addr does so addresses are kept as their 16 byte form.
+type slot struct {
+	ID               storage.PeerID
+	Addr             [16]byte
+	Is4              bool
+	AltAddr          [16]byte
+	AltIs4           bool
+	HasAlt           bool
+	Complete         bool
+	Port             uint16
+	LeechersLastTime uint16
+	Stalled          uint16
+	LastSeen         int64
+	Uploaded         int64
+	Downloaded       int64
+	Left             int64
+	UploadRate       int64
+	DownloadRate     int64
+	WindowStart      int64
+	WindowUploaded   int64
+	WindowDownloaded int64
+}
+
+// ip returns the address of the peer
+func (s *slot) ip() netip.Addr {
+	if s.Is4 {
+		return netip.AddrFrom4([4]byte{s.Addr[12], s.Addr[13], s.Addr[14], s.Addr[15]})
+	}
+	return netip.AddrFrom16(s.Addr)
+}
+
+// alt returns the address of the other family of a dual-stack peer, invalid if it has none
+func (s *slot) alt() netip.Addr {
+	switch {
+	case !s.HasAlt:
+		return netip.Addr{}
+	case s.AltIs4:
+		return netip.AddrFrom4([4]byte{s.AltAddr[12], s.AltAddr[13], s.AltAddr[14], s.AltAddr[15]})
+	}
+	return netip.AddrFrom16(s.AltAddr)
+}
+
+// addr4 returns the 4 byte IPv4 address of the peer, nil if it has none
+func (s *slot) addr4() []byte {
+	switch {
+	case s.Is4:
+		return s.Addr[12:]
+	case s.HasAlt && s.AltIs4:
+		return s.AltAddr[12:]
+	}
+	return nil
+}
+
+// addr6 returns the 16 byte IPv6 address of the peer, nil if it has none
+func (s *slot) addr6() []byte {
+	switch {
+	case !s.Is4:
+		return s.Addr[:]
+	case s.HasAlt && !s.AltIs4:
+		return s.AltAddr[:]
+	}
+	return nil
+}
+
+// peer returns the peer stored in the slot
+func (s *slot) peer() storage.Peer {
+	return storage.Peer{
+		Complete:         s.Complete,
+		IP:               s.ip(),
+		AltIP:            s.alt(),
+		Port:             s.Port,
+		LastSeen:         s.LastSeen,
+		Uploaded:         s.Uploaded,
+		Downloaded:       s.Downloaded,
+		LeechersLastTime: s.LeechersLastTime,
+		Left:             s.Left,
+		Stalled:          s.Stalled,
+		UploadRate:       s.UploadRate,
+		DownloadRate:     s.DownloadRate,
+		WindowStart:      s.WindowStart,
+		WindowUploaded:   s.WindowUploaded,
+		WindowDownloaded: s.WindowDownloaded,
+	}
+}
+
+// set stores the peer in the slot
+func (s *slot) set(peer *storage.Peer) {
+	s.Addr = peer.IP.As16()
+	s.Is4 = peer.IP.Is4()
+	s.AltAddr = peer.AltIP.As16()
+	s.AltIs4 = peer.AltIP.Is4()
+	s.HasAlt = peer.AltIP.IsValid()
+	s.Complete = peer.Complete
+	s.Port = peer.Port
+	s.LastSeen = peer.LastSeen
+	s.Uploaded = peer.Uploaded
+	s.Downloaded = peer.Downloaded
+	s.LeechersLastTime = peer.LeechersLastTime
+	s.Left = peer.Left
+	s.Stalled = peer.Stalled
+	s.UploadRate = peer.UploadRate
+	s.DownloadRate = peer.DownloadRate
+	s.WindowStart = peer.WindowStart
+	s.WindowUploaded = peer.WindowUploaded
+	s.WindowDownloaded = peer.WindowDownloaded
+}
+
+// peers are the peers of a swarm, a slab of slots indexed by peer id.
+// Neither holds pointers so the GC never has to scan them, however many peers there are.
+type peers struct {
+	index map[storage.PeerID]int32
+	slab  []slot
+}
+
+func makePeers(size int) peers {
+	return peers{
+		index: make(map[storage.PeerID]int32, size),
+		slab:  make([]slot, 0, size),
+	}
+}
+
+// len returns the number of peers
+func (p *peers) len() int {
+	return len(p.slab)
+}
+
+// get returns the slot of the peer, it's only valid until a peer is added or removed
+func (p *peers) get(id storage.PeerID) (*slot, bool) {
+	i, ok := p.index[id]
+	if !ok {
+		return nil, false
+	}
+	return &p.slab[i], true
+}
+
+// add returns the slot of a new peer, it's only valid until a peer is added or removed
+func (p *peers) add(id storage.PeerID) *slot {
+	p.index[id] = int32(len(p.slab))
+	p.slab = append(p.slab, slot{ID: id})
+	return &p.slab[len(p.slab)-1]
+}
+
+// put stores the peer, adding it if it's new
+func (p *peers) put(id storage.PeerID, peer *storage.Peer) {
+	s, ok := p.get(id)
+	if !ok {
+		s = p.add(id)
+	}
+	s.set(peer)
+}
+
+// remove deletes the peer by moving the last slot in its place
+func (p *peers) remove(id storage.PeerID) {
+	i, ok := p.index[id]
+	if !ok {
+		return
+	}
+	delete(p.index, id)
+
+	last := len(p.slab) - 1
+	if int(i) != last {
+		p.slab[i] = p.slab[last]
+		p.index[p.slab[i].ID] = i
+	}
+	p.slab[last] = slot{}
+	p.slab = p.slab[:last]
+
+	// give memory back once most of the slab is unused
+	if cap(p.slab) > 64 && len(p.slab) < cap(p.slab)/4 {
+		p.slab = append(make([]slot, 0, cap(p.slab)/2), p.slab...)
+	}
+}
+
+// each calls f with every slot in a random order until f returns false.
+// Slots are visited from a random start with a random stride coprime to the number of peers, so the order changes on every call rather than only where it starts.
+func (p *peers) each(f func(s *slot) bool) {
+	n := len(p.slab)
+	if n == 0 {
+		return
+	}
+
+	start, stride := rand.Intn(n), 1
+	if n > 2 {
+		stride = 1 + rand.Intn(n-1)
+		for gcd(stride, n) != 1 {
+			stride = 1 + rand.Intn(n-1)
+		}
+	}
+	for i, pos := 0, start; i < n; i, pos = i+1, (pos+stride)%n {
+		if !f(&p.slab[pos]) {
+			return
+		}
+	}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,76 @@
+package gomap
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+// peersByID returns the peers keyed by id so swarms can be compared regardless of slot order
+func peersByID(p *peers) map[storage.PeerID]storage.Peer {
+	byID := make(map[storage.PeerID]storage.Peer, p.len())
+	p.each(func(s *slot) bool {
+		byID[s.ID] = s.peer()
+		return true
+	})
+	return byID
+}
+
+func TestPeers(t *testing.T) {
+	p := makePeers(0)
+	ip4 := netip.MustParseAddr("10.0.0.1")
+	ip6 := netip.MustParseAddr("2001:db8::1")
+
+	for i := byte(0); i < 200; i++ {
+		ip := ip4
+		if i%2 == 1 {
+			ip = ip6
+		}
+		p.put(storage.PeerID{i}, &storage.Peer{IP: ip, Port: uint16(i), LastSeen: int64(i)})
+	}
+	p.put(storage.PeerID{0}, &storage.Peer{IP: ip4, Port: 1000})
+	if p.len() != 200 {
+		t.Fatalf("len() = %v, want 200", p.len())
+	}
+
+	// removing moves the last slot, every id must still find its own peer
+	for i := byte(2); i < 200; i += 2 {
+		p.remove(storage.PeerID{i})
+	}
+	p.remove(storage.PeerID{2})
+	if p.len() != 101 {
+		t.Fatalf("len() = %v after removing, want 101", p.len())
+	}
+	for id, peer := range peersByID(&p) {
+		want := ip6
+		if id[0]%2 == 0 {
+			want = ip4
+		}
+		if peer.IP != want || (id[0] != 0 && peer.Port != uint16(id[0])) {
+			t.Errorf("peer %v = %+v", id[0], peer)
+		}
+	}
+	if s, ok := p.get(storage.PeerID{0}); !ok || s.Port != 1000 || string(s.addr4()) != string(ip4.AsSlice()) || s.addr6() != nil {
+		t.Errorf("get(0) = %+v, %v", s, ok)
+	}
+	if s, ok := p.get(storage.PeerID{1}); !ok || string(s.addr6()) != string(ip6.AsSlice()) || s.addr4() != nil {
+		t.Errorf("get(1) = %+v, %v", s, ok)
+	}
+
+	visited := 0
+	p.each(func(s *slot) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("each() visited %v slots after stopping at 10", visited)
+	}
+
+	for i := byte(3); i < 200; i += 2 {
+		p.remove(storage.PeerID{i})
+	}
+	if p.len() != 2 || cap(p.slab) > 64 {
+		t.Errorf("len() = %v and capacity %v after removing most peers, want 2 and the slab given back", p.len(), cap(p.slab))
+	}
+}
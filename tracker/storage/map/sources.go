@@ -0,0 +1,271 @@
+package gomap
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// addSource adds the source to the trusted source maps, the caller must hold the write lock
+func (db *Memory) addSource(source *storage.TrustedSource) {
+	db.trustedSources[source.Name] = source
+	if source.Key == nil {
+		db.trustedAddrs = append(db.trustedAddrs, source)
+	}
+}
+
+// removeSource removes the source from the trusted source maps, the caller must hold the write lock
+func (db *Memory) removeSource(source *storage.TrustedSource) {
+	delete(db.trustedSources, source.Name)
+	for i, keyless := range db.trustedAddrs {
+		if keyless == source {
+			db.trustedAddrs = append(db.trustedAddrs[:i], db.trustedAddrs[i+1:]...)
+			break
+		}
+	}
+}
+
+// keylessSource returns the most specific keyless source matching the address or nil, the caller must hold the read lock
+func (db *Memory) keylessSource(ip netip.Addr, port uint16) (match *storage.TrustedSource) {
+	for _, source := range db.trustedAddrs {
+		if source.Addr.Match(ip, port) && (match == nil || source.Addr.MoreSpecific(&match.Addr)) {
+			match = source
+		}
+	}
+	return
+}
+
+// resolveSources resolves the hostnames of the keyless sources.
+// A source keeps its previous addresses if its hostname fails to resolve.
+func (db *Memory) resolveSources() {
+	db.mutex.RLock()
+	hosts := make(map[string]*storage.TrustedSource)
+	for _, source := range db.trustedAddrs {
+		if source.Addr.Host != "" {
+			hosts[source.Name] = source
+		}
+	}
+	db.mutex.RUnlock()
+
+	for name, source := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		ips, err := source.Addr.Resolve(ctx)
+		cancel()
+		if err != nil {
+			config.Logger.Warn("Failed to resolve trusted source", zap.String("name", name), zap.Error(err))
+			continue
+		}
+
+		db.mutex.Lock()
+		source.Addr.SetResolved(ips)
+		db.mutex.Unlock()
+	}
+}
+
+// TrustedSources returns a copy of all trusted sources sorted by name
+func (db *Memory) TrustedSources() []storage.TrustedSource {
+	db.mutex.RLock()
+	sources := make([]storage.TrustedSource, 0, len(db.trustedSources))
+	for _, source := range db.trustedSources {
+		sources = append(sources, *source)
+	}
+	db.mutex.RUnlock()
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+
+	return sources
+}
+
+// AddTrustedSource adds a new trusted source and saves the trusted sources, the source isn't added if they can't be saved
+func (db *Memory) AddTrustedSource(source *storage.TrustedSource) error {
+	db.sourceChanges.Lock()
+	defer db.sourceChanges.Unlock()
+
+	db.mutex.Lock()
+	if _, ok := db.trustedSources[source.Name]; ok {
+		db.mutex.Unlock()
+		return errors.New("trusted source '" + source.Name + "' already exists")
+	}
+	if source.Key == nil {
+		for _, existing := range db.trustedAddrs {
+			if existing.Addr.Equal(&source.Addr) {
+				db.mutex.Unlock()
+				return errors.New("address already used by trusted source '" + existing.Name + "'")
+			}
+		}
+	}
+	db.addSource(source)
+	db.mutex.Unlock()
+
+	if err := db.saveTrustedSources(); err != nil {
+		db.mutex.Lock()
+		db.removeSource(source)
+		db.mutex.Unlock()
+		return err
+	}
+
+	if source.Addr.Host != "" {
+		db.resolveSources()
+	}
+
+	config.Logger.Info("Added trusted source", zap.String("name", source.Name))
+	return nil
+}
+
+// RemoveTrustedSource removes a trusted source, saves the trusted sources and evicts its baseline providers from every swarm.
+// The source is kept if the trusted sources can't be saved.
+func (db *Memory) RemoveTrustedSource(name string) error {
+	db.sourceChanges.Lock()
+	defer db.sourceChanges.Unlock()
+
+	db.mutex.Lock()
+	source, ok := db.trustedSources[name]
+	if !ok {
+		db.mutex.Unlock()
+		return errors.New("trusted source '" + name + "' does not exist")
+	}
+	db.removeSource(source)
+	db.mutex.Unlock()
+
+	if err := db.saveTrustedSources(); err != nil {
+		db.mutex.Lock()
+		db.addSource(source)
+		db.mutex.Unlock()
+		return err
+	}
+
+	evicted := db.evictSource(name)
+	config.Logger.Info("Removed trusted source", zap.String("name", name), zap.Int("evicted", evicted))
+	return nil
+}
+
+// SuspendTrustedSource stops a trusted source from registering baseline providers until the given time, saves the trusted sources and evicts its baseline providers.
+// A zero or past time lifts the suspension. The suspension is left as it was if the trusted sources can't be saved.
+func (db *Memory) SuspendTrustedSource(name string, until time.Time) error {
+	db.sourceChanges.Lock()
+	defer db.sourceChanges.Unlock()
+
+	db.mutex.Lock()
+	source, ok := db.trustedSources[name]
+	if !ok {
+		db.mutex.Unlock()
+		return errors.New("trusted source '" + name + "' does not exist")
+	}
+	previous := source.SuspendedUntil
+	if until.IsZero() {
+		source.SuspendedUntil = 0
+	} else {
+		source.SuspendedUntil = until.Unix()
+	}
+	suspended := source.Suspended(time.Now().Unix())
+	db.mutex.Unlock()
+
+	if err := db.saveTrustedSources(); err != nil {
+		db.mutex.Lock()
+		source.SuspendedUntil = previous
+		db.mutex.Unlock()
+		return err
+	}
+
+	var evicted int
+	if suspended {
+		evicted = db.evictSource(name)
+	}
+	config.Logger.Info("Suspended trusted source", zap.String("name", name), zap.Time("until", until), zap.Int("evicted", evicted))
+	return nil
+}
+
+// ScopeTrustedSource limits a trusted source to the given infohashes and hash groups, saves the trusted sources and evicts its baseline providers outside of the new scope.
+// No hashes and no groups lifts the limit. The scope is left as it was if the trusted sources can't be saved.
+func (db *Memory) ScopeTrustedSource(name string, hashes []storage.Hash, groups []string) error {
+	db.sourceChanges.Lock()
+	defer db.sourceChanges.Unlock()
+
+	db.mutex.Lock()
+	source, ok := db.trustedSources[name]
+	if !ok {
+		db.mutex.Unlock()
+		return errors.New("trusted source '" + name + "' does not exist")
+	}
+	previousHashes, previousGroups := source.Hashes, source.Groups
+	if err := source.SetScope(hashes, groups); err != nil {
+		db.mutex.Unlock()
+		return err
+	}
+	scoped := *source
+	db.mutex.Unlock()
+
+	if err := db.saveTrustedSources(); err != nil {
+		db.mutex.Lock()
+		source.SetScope(previousHashes, previousGroups) // set before, it can't fail
+		db.mutex.Unlock()
+		return err
+	}
+
+	evicted := db.evictSourceWhere(name, func(hash storage.Hash) bool {
+		return !scoped.InScope(hash)
+	})
+	config.Logger.Info("Scoped trusted source", zap.String("name", name), zap.Int("hashes", len(hashes)), zap.Strings("groups", groups), zap.Int("evicted", evicted))
+	return nil
+}
+
+// inScope returns true if the trusted source may register baseline providers for the hash
+func (db *Memory) inScope(source *storage.TrustedSource, hash storage.Hash) bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return source.InScope(hash)
+}
+
+// trusts returns true if the source is still trusted to register baseline providers for the hash.
+// Sources may be removed, suspended or rescoped between authenticating a provider and storing it, their providers are evicted under the peermap lock
+// so checking again under it keeps evicted providers from coming back.
+func (db *Memory) trusts(source *storage.TrustedSource, hash storage.Hash) bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.trustedSources[source.Name] == source && !source.Suspended(time.Now().Unix()) && source.InScope(hash)
+}
+
+// evictSource removes every baseline provider registered through the named source
+func (db *Memory) evictSource(name string) (evicted int) {
+	return db.evictSourceWhere(name, func(storage.Hash) bool { return true })
+}
+
+// evictSourceWhere removes the baseline providers registered through the named source in the swarms matching evict
+func (db *Memory) evictSourceWhere(name string, evict func(storage.Hash) bool) (evicted int) {
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mutex.RLock()
+		for hash, peermap := range s.hashmap {
+			if !evict(hash) {
+				continue
+			}
+
+			peermap.mutex.Lock()
+			for id, provider := range peermap.BaselineProviders {
+				if provider.Source == name {
+					db.deleteProvider(provider, peermap, id)
+					evicted++
+				}
+			}
+			peermap.mutex.Unlock()
+		}
+		s.mutex.RUnlock()
+	}
+
+	return
+}
+
+func (db *Memory) saveTrustedSources() error {
+	if err := storage.WriteTrustedSources(db.TrustedSources()); err != nil {
+		return errors.Wrap(err, "failed to save trusted sources")
+	}
+	return nil
+}
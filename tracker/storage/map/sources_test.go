@@ -0,0 +1,217 @@
+package gomap
+
+import (
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/pools"
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/crimist/trakx/tracker/storage"
+)
+
+func TestTrustedSourceManagement(t *testing.T) {
+	config.Config.Path.Sources = filepath.Join(t.TempDir(), "sources.json")
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}},
+	}
+	defer func() {
+		config.Config.Path.Sources = ""
+		config.Config.DB.TrustedSources = nil
+	}()
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	source, err := storage.ParseTrustedSource(config.TrustedSource{
+		RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 5000},
+		Name:             "origin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTrustedSource(source); err != nil {
+		t.Fatal("AddTrustedSource() threw error:", err)
+	}
+	if err := db.AddTrustedSource(source); err == nil {
+		t.Error("AddTrustedSource() accepted a duplicate name")
+	}
+
+	if accepted := db.Save(testIP, netip.Addr{}, 5000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}); !accepted {
+		t.Fatal("added trusted source was not accepted")
+	}
+	if _, ok := db.shard(testHash).hashmap[testHash].BaselineProviders[testId]; !ok {
+		t.Fatal("baseline provider not saved")
+	}
+
+	// suspension evicts the providers and refuses new ones
+	if err := db.SuspendTrustedSource("origin", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("SuspendTrustedSource() threw error:", err)
+	}
+	if len(db.shard(testHash).hashmap[testHash].BaselineProviders) != 0 {
+		t.Error("suspended source provider not evicted")
+	}
+	if accepted := db.Save(testIP, netip.Addr{}, 5000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}); accepted {
+		t.Error("suspended source was accepted")
+	}
+
+	// sources survive a restart
+	var restarted Memory
+	restarted.make()
+	sources := restarted.TrustedSources()
+	if len(sources) != 2 {
+		t.Fatalf("restarted trusted sources = %v, want 2", sources)
+	}
+	if sources[1].Name != "origin" || !sources[1].Suspended(time.Now().Unix()) {
+		t.Errorf("restarted source = %+v, want suspended origin", sources[1])
+	}
+
+	// lifting the suspension
+	if err := db.SuspendTrustedSource("origin", time.Time{}); err != nil {
+		t.Fatal("SuspendTrustedSource() threw error:", err)
+	}
+	if accepted := db.Save(testIP, netip.Addr{}, 5000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}); !accepted {
+		t.Error("resumed source was not accepted")
+	}
+
+	// removal evicts the providers
+	if err := db.RemoveTrustedSource("origin"); err != nil {
+		t.Fatal("RemoveTrustedSource() threw error:", err)
+	}
+	if len(db.shard(testHash).hashmap[testHash].BaselineProviders) != 0 {
+		t.Error("removed source provider not evicted")
+	}
+	if err := db.RemoveTrustedSource("origin"); err == nil {
+		t.Error("RemoveTrustedSource() removed a missing source")
+	}
+
+	restarted.make()
+	if sources := restarted.TrustedSources(); len(sources) != 1 || sources[0].Name != "1.2.3.4:4000" {
+		t.Errorf("restarted trusted sources = %v, want only 1.2.3.4:4000", sources)
+	}
+}
+
+func TestTrustedSourceScopeEviction(t *testing.T) {
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	otherHash := storage.Hash{1}
+	for _, hash := range []storage.Hash{testHash, otherHash} {
+		if accepted := db.Save(testIP, netip.Addr{}, 4000, true, false, hash, testId, 0, 0, 0, &storage.ProviderClaim{}); !accepted {
+			t.Fatal("unscoped source was not accepted")
+		}
+	}
+
+	if err := db.ScopeTrustedSource("origin", []storage.Hash{testHash}, nil); err != nil {
+		t.Fatal("ScopeTrustedSource() threw error:", err)
+	}
+	if len(db.shard(testHash).hashmap[testHash].BaselineProviders) != 1 {
+		t.Error("provider within the scope was evicted")
+	}
+	if len(db.shard(otherHash).hashmap[otherHash].BaselineProviders) != 0 {
+		t.Error("provider outside of the scope was not evicted")
+	}
+	if accepted := db.Save(testIP, netip.Addr{}, 4000, true, false, otherHash, testId, 0, 0, 0, &storage.ProviderClaim{}); accepted {
+		t.Error("source was accepted outside of its scope")
+	}
+	if err := db.ScopeTrustedSource("origin", nil, []string{"missing"}); err == nil {
+		t.Error("ScopeTrustedSource() accepted an unknown group")
+	}
+}
+
+func TestTrustedSourceSaveFailure(t *testing.T) {
+	// the sources can't be written to a missing directory
+	config.Config.Path.Sources = filepath.Join(t.TempDir(), "missing", "sources.json")
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	defer func() {
+		config.Config.Path.Sources = ""
+		config.Config.DB.TrustedSources = nil
+	}()
+
+	var db Memory
+	db.make()
+	pools.Initialize(10)
+
+	if accepted := db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}); !accepted {
+		t.Fatal("trusted source was not accepted")
+	}
+	before := db.TrustedSources()
+
+	source, err := storage.ParseTrustedSource(config.TrustedSource{
+		RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 5000},
+		Name:             "other",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTrustedSource(source); err == nil {
+		t.Error("AddTrustedSource() didn't fail")
+	}
+	if err := db.RemoveTrustedSource("origin"); err == nil {
+		t.Error("RemoveTrustedSource() didn't fail")
+	}
+	if err := db.SuspendTrustedSource("origin", time.Now().Add(time.Hour)); err == nil {
+		t.Error("SuspendTrustedSource() didn't fail")
+	}
+	if err := db.ScopeTrustedSource("origin", []storage.Hash{{1}}, nil); err == nil {
+		t.Error("ScopeTrustedSource() didn't fail")
+	}
+
+	// failed changes are undone and don't evict
+	if after := db.TrustedSources(); !reflect.DeepEqual(before, after) {
+		t.Errorf("trusted sources after failed changes = %+v, want %+v", after, before)
+	}
+	if len(db.shard(testHash).hashmap[testHash].BaselineProviders) != 1 {
+		t.Error("provider evicted by a failed change")
+	}
+	if accepted := db.Save(testIP, netip.Addr{}, 4000, true, false, testHash, testId, 0, 0, 0, &storage.ProviderClaim{}); !accepted {
+		t.Error("trusted source not accepted after failed changes")
+	}
+}
+
+func TestTrusts(t *testing.T) {
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{
+		{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"},
+	}
+	defer func() { config.Config.DB.TrustedSources = nil }()
+
+	var db Memory
+	db.make()
+
+	// a provider authenticated before its source was removed isn't stored after the eviction
+	source := db.authenticate(testIP, 4000, &storage.ProviderClaim{}, nil)
+	if source == nil || !db.trusts(source, testHash) {
+		t.Fatal("trusted source not trusted")
+	}
+	if err := db.RemoveTrustedSource("origin"); err != nil {
+		t.Fatal("RemoveTrustedSource() threw error:", err)
+	}
+	if db.trusts(source, testHash) {
+		t.Error("removed source still trusted")
+	}
+
+	// nor is one of a source re-added under the same name
+	readded, err := storage.ParseTrustedSource(config.TrustedSource{RawSocketAddress: config.RawSocketAddress{IP: "1.2.3.4", Port: 4000}, Name: "origin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTrustedSource(readded); err != nil {
+		t.Fatal("AddTrustedSource() threw error:", err)
+	}
+	if db.trusts(source, testHash) {
+		t.Error("replaced source still trusted")
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+// maxPenaltyEscalation caps how many times a penalty doubles or halves with repeat offences.
+const maxPenaltyEscalation = 16
+
+// maxBanDuration caps escalated bans, doubling a long ban 16 times would otherwise overflow time.Duration.
+const maxBanDuration = 30 * 24 * time.Hour
+
+// Penalty holds the standing of an address: its recent offences as a bad actor and its reputation across all swarms.
+// The consequences of offences are set by Behavior.Penalty and escalate with each recent offence.
+// A negative reputation shrinks numwant and a reputation below Reputation.BaselineMin withholds baseline providers.
+type Penalty struct {
+	Offences    uint    // recent offences, 0 if in good standing
+	BannedUntil int64   // unix time, announces are refused before
+	Reputation  float64 // decayed reputation score, within ±Reputation.Max
+}
+
+func (penalty Penalty) escalation() uint {
+	if penalty.Offences > maxPenaltyEscalation {
+		return maxPenaltyEscalation
+	}
+	return penalty.Offences
+}
+
+// Banned returns true if announces are refused at the unix time now.
+func (penalty Penalty) Banned(now int64) bool {
+	return penalty.BannedUntil > now
+}
+
+// Numwant caps numwant, the cap halves with each repeat offence.
+// A negative reputation scales numwant down, to 0 at -Reputation.Max.
+func (penalty Penalty) Numwant(numwant uint) uint {
+	if max := config.Config.Reputation.Max; penalty.Reputation < 0 && max > 0 {
+		numwant = uint(float64(numwant) * (1 + penalty.Reputation/max))
+	}
+
+	limit := config.Config.Behavior.Penalty.Numwant
+	if penalty.Offences == 0 || limit == 0 {
+		return numwant
+	}
+
+	if limit >>= penalty.escalation() - 1; numwant > limit {
+		return limit
+	}
+	return numwant
+}
+
+// Interval lengthens the announce interval in seconds for each recent offence.
+func (penalty Penalty) Interval(interval int64) int64 {
+	return interval + int64(penalty.escalation())*int64(config.Config.Behavior.Penalty.Interval/time.Second)
+}
+
+// WithholdBaseline returns true if baseline providers shouldn't be handed out.
+func (penalty Penalty) WithholdBaseline() bool {
+	return (penalty.Offences > 0 && config.Config.Behavior.Penalty.WithholdBaseline) || penalty.Reputation < config.Config.Reputation.BaselineMin
+}
+
+// GoodActor returns true if the address has no unforgiven offences and enough reputation to be handed baseline providers.
+func (penalty Penalty) GoodActor() bool {
+	return penalty.Offences == 0 && penalty.Reputation >= config.Config.Reputation.BaselineMin
+}
+
+// BanDuration returns how long to ban for after the given number of recent offences, 0 if it doesn't warrant a ban.
+// The duration doubles for each offence past Behavior.Penalty.BanOffences, up to maxBanDuration.
+func BanDuration(offences uint) time.Duration {
+	banOffences := config.Config.Behavior.Penalty.BanOffences
+	if banOffences == 0 || offences < banOffences {
+		return 0
+	}
+
+	escalation := offences - banOffences
+	if escalation > maxPenaltyEscalation {
+		escalation = maxPenaltyEscalation
+	}
+	// checked before shifting so it can't overflow
+	if duration := config.Config.Behavior.Penalty.BanDuration; duration <= maxBanDuration>>escalation {
+		return duration << escalation
+	}
+	return maxBanDuration
+}
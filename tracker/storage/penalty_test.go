@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestPenalty(t *testing.T) {
+	original := config.Config.Behavior.Penalty
+	defer func() { config.Config.Behavior.Penalty = original }()
+
+	config.Config.Behavior.Penalty.Numwant = 20
+	config.Config.Behavior.Penalty.Interval = time.Minute
+	config.Config.Behavior.Penalty.WithholdBaseline = true
+	config.Config.Behavior.Penalty.BanOffences = 3
+	config.Config.Behavior.Penalty.BanDuration = time.Minute
+
+	cases := []struct {
+		name     string
+		offences uint
+		numwant  uint
+		interval int64
+		withhold bool
+		ban      time.Duration
+	}{
+		{"goodStanding", 0, 50, 1800, false, 0},
+		{"first", 1, 20, 1860, true, 0},
+		{"second", 2, 10, 1920, true, 0},
+		{"banned", 3, 5, 1980, true, time.Minute},
+		{"rebanned", 4, 2, 2040, true, 2 * time.Minute},
+		{"escalated", 2 + maxPenaltyEscalation, 0, 1800 + 60*maxPenaltyEscalation, true, time.Minute << (maxPenaltyEscalation - 1)},
+		{"escalationLimit", 3 + maxPenaltyEscalation, 0, 1800 + 60*maxPenaltyEscalation, true, maxBanDuration},
+		{"pastLimit", 10 + maxPenaltyEscalation, 0, 1800 + 60*maxPenaltyEscalation, true, maxBanDuration},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			penalty := Penalty{Offences: c.offences}
+			if numwant := penalty.Numwant(50); numwant != c.numwant {
+				t.Errorf("Numwant(50) = %v, want %v", numwant, c.numwant)
+			}
+			if interval := penalty.Interval(1800); interval != c.interval {
+				t.Errorf("Interval(1800) = %v, want %v", interval, c.interval)
+			}
+			if withhold := penalty.WithholdBaseline(); withhold != c.withhold {
+				t.Errorf("WithholdBaseline() = %v, want %v", withhold, c.withhold)
+			}
+			if ban := BanDuration(c.offences); ban != c.ban {
+				t.Errorf("BanDuration(%v) = %v, want %v", c.offences, ban, c.ban)
+			}
+		})
+	}
+
+	// a long ban doubled to the escalation limit would overflow
+	config.Config.Behavior.Penalty.BanDuration = 24 * time.Hour
+	if ban := BanDuration(3 + maxPenaltyEscalation); ban != maxBanDuration {
+		t.Errorf("BanDuration(%v) = %v, want %v", 3+maxPenaltyEscalation, ban, maxBanDuration)
+	}
+	if ban := BanDuration(4); ban != 48*time.Hour {
+		t.Errorf("BanDuration(4) = %v, want %v", ban, 48*time.Hour)
+	}
+}
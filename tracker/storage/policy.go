@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+// Swarm holds the state of the swarm a peer is judged in, it includes the peer.
+// Rates is the sum of the transfer rates of every peer in the swarm.
+type Swarm struct {
+	Complete   uint16
+	Incomplete uint16
+	Rates      Rates
+}
+
+// BehaviorPolicy decides whether an announce is bad acting.
+// Previous is the state of the peer at its last announce or nil if it is new, current is the state about to be saved.
+// Policies may keep bookkeeping in the Window fields of current, they are carried over from previous by the driver.
+// The transfer rates of current are measured by the driver before the policy is called.
+type BehaviorPolicy interface {
+	BadActor(previous *Peer, current *Peer, swarm Swarm) bool
+}
+
+var policies = map[string]BehaviorPolicy{
+	config.BehaviorPolicyFreeRider:  FreeRiderPolicy{},
+	config.BehaviorPolicyRatio:      RatioPolicy{},
+	config.BehaviorPolicyUploadRate: UploadRatePolicy{},
+}
+
+// RegisterPolicy makes a bad actor detection policy available under the name, it must be called before the database is opened.
+func RegisterPolicy(name string, policy BehaviorPolicy) {
+	policies[name] = policy
+}
+
+// GetPolicy returns the bad actor detection policy registered under the name.
+func GetPolicy(name string) (BehaviorPolicy, error) {
+	policy, ok := policies[name]
+	if !ok {
+		return nil, errors.New("Invalid behavior policy: '" + name + "'")
+	}
+	return policy, nil
+}
+
+// FreeRiderPolicy flags leechers that downloaded but didn't upload since their last announce while other leechers were in the swarm.
+type FreeRiderPolicy struct{}
+
+func (FreeRiderPolicy) BadActor(previous *Peer, current *Peer, swarm Swarm) bool {
+	// there is nothing to compare new peers against
+	if previous == nil || current.Complete {
+		return false
+	}
+
+	return current.Uploaded == previous.Uploaded && current.Downloaded > previous.Downloaded && previous.LeechersLastTime >= config.Config.Behavior.MinLeechers
+}
+
+// RatioPolicy flags leechers that made progress while their share ratio is below Behavior.Ratio.Min.
+// Leechers are only judged once they downloaded Behavior.Ratio.MinDownloaded bytes and other leechers are in the swarm.
+type RatioPolicy struct{}
+
+func (RatioPolicy) BadActor(previous *Peer, current *Peer, swarm Swarm) bool {
+	if previous == nil || current.Complete || current.Downloaded <= previous.Downloaded {
+		return false
+	}
+	if current.Downloaded < config.Config.Behavior.Ratio.MinDownloaded || swarm.Incomplete < config.Config.Behavior.MinLeechers {
+		return false
+	}
+
+	return float64(current.Uploaded)/float64(current.Downloaded) < config.Config.Behavior.Ratio.Min
+}
+
+// UploadRatePolicy flags leechers that made progress while uploading slower than Behavior.UploadRate.Min bytes per second.
+// The rate is measured over windows of at least Behavior.UploadRate.Window so single announces don't decide.
+type UploadRatePolicy struct{}
+
+func (UploadRatePolicy) BadActor(previous *Peer, current *Peer, swarm Swarm) bool {
+	if current.WindowStart == 0 {
+		current.startWindow()
+		return false
+	}
+
+	elapsed := current.LastSeen - current.WindowStart
+	if elapsed < int64(config.Config.Behavior.UploadRate.Window.Seconds()) || elapsed <= 0 {
+		return false
+	}
+
+	rate := (current.Uploaded - current.WindowUploaded) / elapsed
+	progressed := current.Downloaded > current.WindowDownloaded
+	current.startWindow()
+
+	return !current.Complete && progressed && swarm.Incomplete >= config.Config.Behavior.MinLeechers && rate < config.Config.Behavior.UploadRate.Min
+}
+
+func (peer *Peer) startWindow() {
+	peer.WindowStart = peer.LastSeen
+	peer.WindowUploaded = peer.Uploaded
+	peer.WindowDownloaded = peer.Downloaded
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestBehaviorPolicies(t *testing.T) {
+	original := config.Config.Behavior
+	defer func() { config.Config.Behavior = original }()
+	config.Config.Behavior.MinLeechers = 2
+	config.Config.Behavior.Ratio.Min = 0.5
+	config.Config.Behavior.Ratio.MinDownloaded = 100
+	config.Config.Behavior.UploadRate.Window = 10 * time.Second
+	config.Config.Behavior.UploadRate.Min = 10
+
+	swarm := Swarm{Complete: 1, Incomplete: 3}
+	cases := []struct {
+		name     string
+		policy   string
+		previous *Peer
+		current  Peer
+		swarm    Swarm
+		bad      bool
+	}{
+		{"freeriderNew", config.BehaviorPolicyFreeRider, nil, Peer{Downloaded: 100}, swarm, false},
+		{"freeriderLeeching", config.BehaviorPolicyFreeRider, &Peer{Downloaded: 50, LeechersLastTime: 3}, Peer{Downloaded: 100}, swarm, true},
+		{"freeriderUploading", config.BehaviorPolicyFreeRider, &Peer{Downloaded: 50, LeechersLastTime: 3}, Peer{Uploaded: 1, Downloaded: 100}, swarm, false},
+		{"freeriderAlone", config.BehaviorPolicyFreeRider, &Peer{Downloaded: 50, LeechersLastTime: 1}, Peer{Downloaded: 100}, swarm, false},
+		{"ratioLow", config.BehaviorPolicyRatio, &Peer{Downloaded: 100}, Peer{Uploaded: 10, Downloaded: 200}, swarm, true},
+		{"ratioHigh", config.BehaviorPolicyRatio, &Peer{Downloaded: 100}, Peer{Uploaded: 150, Downloaded: 200}, swarm, false},
+		{"ratioTooEarly", config.BehaviorPolicyRatio, &Peer{Downloaded: 10}, Peer{Downloaded: 50}, swarm, false},
+		{"ratioAlone", config.BehaviorPolicyRatio, &Peer{Downloaded: 100}, Peer{Downloaded: 200}, Swarm{Incomplete: 1}, false},
+		{"rateStartsWindow", config.BehaviorPolicyUploadRate, nil, Peer{LastSeen: 100}, swarm, false},
+		{"rateWithinWindow", config.BehaviorPolicyUploadRate, &Peer{}, Peer{LastSeen: 105, Downloaded: 100, WindowStart: 100}, swarm, false},
+		{"rateSlow", config.BehaviorPolicyUploadRate, &Peer{}, Peer{LastSeen: 120, Uploaded: 20, Downloaded: 100, WindowStart: 100}, swarm, true},
+		{"rateFast", config.BehaviorPolicyUploadRate, &Peer{}, Peer{LastSeen: 120, Uploaded: 400, Downloaded: 100, WindowStart: 100}, swarm, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy, err := GetPolicy(c.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bad := policy.BadActor(c.previous, &c.current, c.swarm); bad != c.bad {
+				t.Errorf("BadActor() = %v, want %v", bad, c.bad)
+			}
+		})
+	}
+
+	if _, err := GetPolicy("missing"); err == nil {
+		t.Error("GetPolicy() returned a policy for an unknown name")
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import "net/netip"
+
+// Rates holds transfer rates in bytes per second.
+type Rates struct {
+	Upload   int64
+	Download int64
+}
+
+// PeerRates holds the transfer rates of a peer in a swarm.
+type PeerRates struct {
+	ID   PeerID
+	IP   netip.Addr
+	Port uint16
+	Rates
+}
+
+// MeasureRates sets the transfer rates of the peer from the bytes transferred since the previous announce.
+// Announces within the same second as the previous one keep its rates, new peers have no rates.
+func (peer *Peer) MeasureRates(previous *Peer) {
+	if previous == nil {
+		peer.UploadRate, peer.DownloadRate = 0, 0
+		return
+	}
+
+	elapsed := peer.LastSeen - previous.LastSeen
+	if elapsed <= 0 {
+		peer.UploadRate, peer.DownloadRate = previous.UploadRate, previous.DownloadRate
+		return
+	}
+
+	peer.UploadRate = deltaRate(previous.Uploaded, peer.Uploaded, elapsed)
+	peer.DownloadRate = deltaRate(previous.Downloaded, peer.Downloaded, elapsed)
+}
+
+// deltaRate returns the rate between two transfer counters, counters that went backwards (ex: client restarts) have no rate
+func deltaRate(previous, current, elapsed int64) int64 {
+	if current <= previous {
+		return 0
+	}
+	return (current - previous) / elapsed
+}
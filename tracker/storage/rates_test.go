@@ -0,0 +1,29 @@
+package storage
+
+import "testing"
+
+func TestMeasureRates(t *testing.T) {
+	previous := Peer{LastSeen: 100, Uploaded: 1000, Downloaded: 5000, UploadRate: 7, DownloadRate: 9}
+
+	var cases = []struct {
+		name     string
+		previous *Peer
+		current  Peer
+		upload   int64
+		download int64
+	}{
+		{"new", nil, Peer{LastSeen: 110, Uploaded: 1000}, 0, 0},
+		{"deltas", &previous, Peer{LastSeen: 110, Uploaded: 2000, Downloaded: 5500}, 100, 50},
+		{"sameSecond", &previous, Peer{LastSeen: 100, Uploaded: 2000, Downloaded: 6000}, 7, 9},
+		{"reset", &previous, Peer{LastSeen: 110, Uploaded: 10, Downloaded: 10}, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.current.MeasureRates(c.previous)
+			if c.current.UploadRate != c.upload || c.current.DownloadRate != c.download {
+				t.Errorf("MeasureRates() = %v/%v, want %v/%v", c.current.UploadRate, c.current.DownloadRate, c.upload, c.download)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/pkg/errors"
+)
+
+// ReportType is the misbehaviour a peer is reported for.
+type ReportType uint8
+
+const (
+	ReportNoUpload ReportType = 1 // refuses to upload
+	ReportCorrupt  ReportType = 2 // sends corrupt pieces
+	ReportLying    ReportType = 3 // lies about its transfer totals
+
+	reportMessageSize = 6 + 20 + 20 + 2 + 1 + 20 + 16 + 2 + 8
+)
+
+var (
+	reportTypes = map[string]ReportType{
+		"noupload": ReportNoUpload,
+		"corrupt":  ReportCorrupt,
+		"lying":    ReportLying,
+	}
+	reportMessagePrefix = []byte("report")
+
+	ErrReportType    = errors.New("invalid report type")
+	ErrReportTarget  = errors.New("reported peer not in the swarm")
+	ErrReporter      = errors.New("reporter not in the swarm")
+	ErrReportsClosed = errors.New("reports from peers are disabled")
+	ErrReportLimit   = errors.New("report rate limit exceeded")
+)
+
+// ParseReportType parses the name of a report type, ex: "corrupt".
+func ParseReportType(name string) (ReportType, error) {
+	reportType, ok := reportTypes[name]
+	if !ok {
+		return 0, ErrReportType
+	}
+	return reportType, nil
+}
+
+// Valid returns true if the report type is known.
+func (reportType ReportType) Valid() bool {
+	return reportType >= ReportNoUpload && reportType <= ReportLying
+}
+
+func (reportType ReportType) String() string {
+	for name, t := range reportTypes {
+		if t == reportType {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Report is a report of a misbehaving peer, identified by its peer ID or, if it has none, its endpoint.
+type Report struct {
+	Hash     Hash
+	Reporter PeerID // peer ID of the reporter
+	Port     uint16 // port of the reporter
+	Type     ReportType
+	Target   PeerID
+	Endpoint netip.AddrPort
+}
+
+// Message builds the message a trusted source signs when reporting.
+// All integers are big endian: "report" (6) | hash (20) | reporter peer id (20) | port (2) | type (1) | target peer id (20) | target ip (16) | target port (2) | timestamp (8)
+// IPv4 target ips are IPv4 mapped, a target without an endpoint has a zero ip and port.
+func (report *Report) Message(timestamp int64) []byte {
+	message := make([]byte, reportMessageSize)
+
+	copy(message[0:6], reportMessagePrefix)
+	copy(message[6:26], report.Hash[:])
+	copy(message[26:46], report.Reporter[:])
+	binary.BigEndian.PutUint16(message[46:48], report.Port)
+	message[48] = byte(report.Type)
+	copy(message[49:69], report.Target[:])
+	if report.Endpoint.IsValid() {
+		ip := report.Endpoint.Addr().As16()
+		copy(message[69:85], ip[:])
+		binary.BigEndian.PutUint16(message[85:87], report.Endpoint.Port())
+	}
+	binary.BigEndian.PutUint64(message[87:95], uint64(timestamp))
+
+	return message
+}
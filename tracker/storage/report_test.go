@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestParseReportType(t *testing.T) {
+	for _, name := range []string{"noupload", "corrupt", "lying"} {
+		reportType, err := ParseReportType(name)
+		if err != nil {
+			t.Fatalf("ParseReportType(%v) threw error: %v", name, err)
+		}
+		if reportType.String() != name {
+			t.Errorf("ParseReportType(%v).String() = %v", name, reportType.String())
+		}
+	}
+
+	if _, err := ParseReportType("rude"); err == nil {
+		t.Error("ParseReportType() accepted an unknown type")
+	}
+}
+
+func TestReportMessage(t *testing.T) {
+	report := Report{Hash: Hash{1}, Reporter: PeerID{2}, Port: 0x0102, Type: ReportLying, Endpoint: netip.MustParseAddrPort("1.2.3.4:5")}
+	message := report.Message(7)
+
+	if len(message) != reportMessageSize {
+		t.Fatalf("len(Message()) = %v, want %v", len(message), reportMessageSize)
+	}
+	if !bytes.Equal(message[69:87], []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 1, 2, 3, 4, 0, 5}) {
+		t.Errorf("Message() target endpoint = %v, want IPv4 mapped 1.2.3.4:5", message[69:87])
+	}
+	if message[48] != byte(ReportLying) || message[94] != 7 {
+		t.Errorf("Message() type = %v timestamp = %v, want %v and 7", message[48], message[94], ReportLying)
+	}
+}
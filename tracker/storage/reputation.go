@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"math"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+// DecayReputation returns the reputation score elapsed seconds later, it halves every Reputation.HalfLife.
+func DecayReputation(score float64, elapsed int64) float64 {
+	halfLife := config.Config.Reputation.HalfLife.Seconds()
+	if elapsed <= 0 || halfLife <= 0 {
+		return score
+	}
+	return score * math.Exp2(-float64(elapsed)/halfLife)
+}
+
+// AddReputation adds delta to the reputation score, keeping it within ±Reputation.Max.
+func AddReputation(score float64, delta float64) float64 {
+	max := config.Config.Reputation.Max
+	return math.Max(-max, math.Min(max, score+delta))
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"encoding/hex"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+)
+
+// ParseHash parses a hex encoded infohash.
+func ParseHash(raw string) (hash Hash, err error) {
+	data, err := hex.DecodeString(raw)
+	if err != nil {
+		return hash, errors.Wrap(err, "failed to decode infohash hex")
+	}
+	if len(data) != len(hash) {
+		return hash, errors.Errorf("infohash must be %d bytes", len(hash))
+	}
+
+	copy(hash[:], data)
+	return hash, nil
+}
+
+// SetScope limits the source to the given infohashes and hash groups, no hashes and no groups lifts the limit.
+// Groups are resolved against DB.HashGroups when the scope is set.
+func (source *TrustedSource) SetScope(hashes []Hash, groups []string) error {
+	if len(hashes) == 0 && len(groups) == 0 {
+		source.Hashes, source.Groups, source.scope = nil, nil, nil
+		return nil
+	}
+
+	scope := make(map[Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		scope[hash] = struct{}{}
+	}
+	for _, group := range groups {
+		rawHashes, ok := config.Config.DB.HashGroups[group]
+		if !ok {
+			return errors.New("unknown hash group '" + group + "'")
+		}
+		for _, raw := range rawHashes {
+			hash, err := ParseHash(raw)
+			if err != nil {
+				return errors.Wrap(err, "invalid infohash in hash group '"+group+"'")
+			}
+			scope[hash] = struct{}{}
+		}
+	}
+
+	source.Hashes, source.Groups, source.scope = hashes, groups, scope
+	return nil
+}
+
+// InScope returns true if the source may register baseline providers for the hash.
+func (source *TrustedSource) InScope(hash Hash) bool {
+	if source.scope == nil {
+		return true
+	}
+	_, ok := source.scope[hash]
+	return ok
+}
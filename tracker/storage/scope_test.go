@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestTrustedSourceScope(t *testing.T) {
+	inGroup := strings.Repeat("01", 20)
+	listed := strings.Repeat("02", 20)
+	config.Config.DB.HashGroups = map[string][]string{"releases": {inGroup}}
+	defer func() { config.Config.DB.HashGroups = nil }()
+
+	source, err := ParseTrustedSource(config.TrustedSource{
+		Name:   "origin",
+		Key:    "hmac:736563726574",
+		Hashes: []string{listed},
+		Groups: []string{"releases"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		hash  Hash
+		scope bool
+	}{
+		{"listed", Hash{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}, true},
+		{"group", Hash{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, true},
+		{"other", Hash{3}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if scope := source.InScope(c.hash); scope != c.scope {
+				t.Errorf("InScope() = %v, want %v", scope, c.scope)
+			}
+		})
+	}
+
+	if raw := source.Raw(); len(raw.Hashes) != 1 || raw.Hashes[0] != listed || len(raw.Groups) != 1 {
+		t.Errorf("Raw() = %+v, want the configured hashes and groups", raw)
+	}
+
+	if err := source.SetScope(nil, nil); err != nil || !source.InScope(Hash{3}) {
+		t.Error("SetScope(nil, nil) did not lift the scope")
+	}
+	if err := source.SetScope(nil, []string{"missing"}); err == nil {
+		t.Error("SetScope() accepted an unknown group")
+	}
+	if _, err := ParseTrustedSource(config.TrustedSource{Name: "bad", Key: "hmac:00", Hashes: []string{"00ff"}}); err == nil {
+		t.Error("ParseTrustedSource() accepted a short infohash")
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/crimist/trakx/tracker/config"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// trustedSourceRecord is the on disk representation of a trusted source.
+type trustedSourceRecord struct {
+	config.TrustedSource
+	SuspendedUntil int64 `json:",omitempty"`
+}
+
+// Suspended returns true if the source is suspended at the unix time now.
+func (source *TrustedSource) Suspended(now int64) bool {
+	return source.SuspendedUntil > now
+}
+
+// Raw converts the trusted source back to its configuration form.
+func (source *TrustedSource) Raw() config.TrustedSource {
+	raw := config.TrustedSource{
+		Name: source.Name,
+	}
+	if source.Addr.IsValid() {
+		raw.RawSocketAddress = source.Addr.Raw()
+	}
+	if source.Key != nil {
+		raw.Key = source.Key.String()
+	}
+	for _, hash := range source.Hashes {
+		raw.Hashes = append(raw.Hashes, hex.EncodeToString(hash[:]))
+	}
+	raw.Groups = source.Groups
+
+	return raw
+}
+
+// LoadTrustedSources loads the trusted sources from the sources file if it exists, otherwise from the configuration.
+// Once the sources file exists edits to db.trustedSources are ignored, a warning is logged when it has entries.
+// Any invalid source fails the load.
+func LoadTrustedSources() ([]*TrustedSource, error) {
+	records, err := readTrustedSources(config.Config.Path.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	if records != nil && len(config.Config.DB.TrustedSources) > 0 {
+		config.Logger.Warn("Trusted sources file overrides db.trustedSources, remove it to use the configuration", zap.String("path", config.Config.Path.Sources))
+	}
+	if records == nil {
+		for _, raw := range config.Config.DB.TrustedSources {
+			records = append(records, trustedSourceRecord{TrustedSource: raw})
+		}
+	}
+
+	sources := make([]*TrustedSource, 0, len(records))
+	for i, record := range records {
+		source, err := ParseTrustedSource(record.TrustedSource)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted source %d (%v)", i, record.Name)
+		}
+		source.SuspendedUntil = record.SuspendedUntil
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+func readTrustedSources(path string) ([]trustedSourceRecord, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read trusted sources file")
+	}
+
+	records := []trustedSourceRecord{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, errors.Wrap(err, "failed to decode trusted sources file")
+	}
+
+	return records, nil
+}
+
+// WriteTrustedSources saves the trusted sources to the sources file so runtime changes survive a restart.
+func WriteTrustedSources(sources []TrustedSource) error {
+	if config.Config.Path.Sources == "" {
+		return nil
+	}
+
+	records := make([]trustedSourceRecord, len(sources))
+	for i := range sources {
+		records[i] = trustedSourceRecord{
+			TrustedSource:  sources[i].Raw(),
+			SuspendedUntil: sources[i].SuspendedUntil,
+		}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode trusted sources")
+	}
+
+	if err := writePrivate(config.Config.Path.Sources, data); err != nil {
+		return errors.Wrap(err, "failed to write trusted sources file")
+	}
+
+	return nil
+}
+
+// writePrivate replaces the file with data readable by the owner only, it's written to a temporary file first so the file is never left partially written
+func writePrivate(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp") // created 0600
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails once renamed
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
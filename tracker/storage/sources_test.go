@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crimist/trakx/tracker/config"
+)
+
+func TestWriteTrustedSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.json")
+	config.Config.Path.Sources = path
+	defer func() { config.Config.Path.Sources = "" }()
+
+	if err := os.WriteFile(path, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTrustedSources([]TrustedSource{{Name: "origin", Key: &SourceKey{Type: KeyTypeHMAC, Data: []byte("secret")}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("sources file mode = %v, want 0600", perm)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("sources directory holds %v files, want 1", len(entries))
+	}
+
+	records, err := readTrustedSources(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Key != "hmac:736563726574" {
+		t.Errorf("readTrustedSources() = %+v", records)
+	}
+}
@@ -12,16 +12,74 @@ type (
 	Peer struct {
 		Complete         bool
 		IP               netip.Addr
+		AltIP            netip.Addr // address of the other family a dual-stack peer announced (BEP 7), invalid if none
 		Port             uint16
 		LastSeen         int64
 		Uploaded         int64
 		Downloaded       int64
 		LeechersLastTime uint16
+		Left             int64  // bytes left to download as of the last announce
+		Stalled          uint16 // announces left hasn't decreased for
+
+		// transfer rates in bytes per second since the previous announce
+		UploadRate   int64
+		DownloadRate int64
+
+		// behavior policy bookkeeping over a window of announces
+		WindowStart      int64
+		WindowUploaded   int64
+		WindowDownloaded int64
 	}
 
-	// Reliable source contains IP and port of a known reliable source.
+	// ReliableSource holds the addresses and ports a keyless trusted source announces from.
+	// Addresses are either a prefix, single IPs being full length prefixes, or a hostname that is resolved on a schedule.
 	ReliableSource struct {
+		Prefix  netip.Prefix
+		Host    string
+		PortMin uint16
+		PortMax uint16
+
+		resolved []netip.Addr // addresses Host resolved to
+	}
+
+	// TrustedSource is a known reliable source allowed to register as a baseline provider.
+	// Sources with a key must sign their announces, sources without one are matched by address.
+	TrustedSource struct {
+		Name           string
+		Addr           ReliableSource
+		Key            *SourceKey
+		SuspendedUntil int64 // unix time, the source may not register baseline providers before
+		Hashes         []Hash
+		Groups         []string
+
+		scope map[Hash]struct{} // hashes the source may register for, nil if unlimited
+	}
+
+	// Requester is the announcing peer a peer list is picked for.
+	Requester struct {
+		ID       PeerID
+		IP       netip.Addr
+		Complete bool
+		Penalty  Penalty // standing of the requester, shapes which peers it is handed
+	}
+
+	// Leecher is a peer a baseline provider is authorised to serve.
+	Leecher struct {
+		ID   PeerID
 		IP   netip.Addr
 		Port uint16
 	}
+
+	// ProviderClaim holds the credentials a peer presents when announcing as a baseline provider.
+	// An empty claim falls back to matching the announce address against keyless trusted sources.
+	ProviderClaim struct {
+		Source    string // name of the trusted source
+		Timestamp int64  // unix time the signature was created at
+		Signature []byte // signature over SignedMessage
+		Capacity  uint16 // advertised upload slots, 0 if not advertised
+
+		// announce parameters that don't reach Save, they're covered by the signature
+		Event       uint8  // EventNone, EventCompleted or EventStarted
+		NumBaseline uint32 // numbaseline as sent, 0 if not sent
+	}
 )
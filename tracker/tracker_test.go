@@ -2,6 +2,7 @@ package tracker
 
 import (
 	"fmt"
+	"os"
 	"syscall"
 	"testing"
 	"time"
@@ -38,6 +39,8 @@ func TestMain(m *testing.M) {
 	config.Config.DB.Trim = oneHour
 	config.Config.DB.Backup.Frequency = 0
 	config.Config.DB.Expiry = oneHour
+	config.Config.Path.Sources = ""
+	config.Config.DB.TrustedSources = []config.TrustedSource{{RawSocketAddress: config.RawSocketAddress{IP: "127.0.0.1", Port: 4000}}}
 	config.Config.UDP.ConnDB.Trim = oneHour
 	config.Config.UDP.ConnDB.Expiry = oneHour
 
@@ -47,7 +50,10 @@ func TestMain(m *testing.M) {
 	time.Sleep(100 * time.Millisecond) // wait for run to complete
 	fmt.Println("started!")
 
-	m.Run()
+	// the signal handler exits successfully, failures exit before it runs
+	if code := m.Run(); code != 0 {
+		os.Exit(code)
+	}
 
 	fmt.Println("Shutting down mock tracker...")
 	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
@@ -1,17 +1,74 @@
 package udp
 
 import (
+	"bytes"
+	"encoding/hex"
+	"math"
 	"math/rand"
 	"net"
 	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/crimist/trakx/pools"
 	"github.com/crimist/trakx/tracker/config"
 	"github.com/crimist/trakx/tracker/stats"
+	"github.com/crimist/trakx/tracker/storage"
 	"github.com/crimist/trakx/tracker/udp/protocol"
 )
 
-func (u *UDPTracker) announce(announce *protocol.Announce, remote *net.UDPAddr, addrPort netip.AddrPort) {
+// announceOptions holds the ReliableBT parameters passed through BEP 41 URL data.
+type announceOptions struct {
+	extended         bool // client understands the ReliableBT response extension
+	baselineProvider bool
+	numbaseline      uint // number of baseline providers wanted
+	claim            storage.ProviderClaim
+}
+
+// parseAnnounceOptions parses the query of the URL data, ex: "/announce?baselineProvider=1".
+// Any client that sends the `baselineProvider` key, regardless of value, is considered ReliableBT aware.
+func parseAnnounceOptions(urlData []byte) (options announceOptions) {
+	options.numbaseline = config.Config.Baseline.Numwant.Default
+
+	query := urlData
+	if i := bytes.IndexByte(urlData, '?'); i != -1 {
+		query = urlData[i+1:]
+	}
+	if len(query) == 0 {
+		return
+	}
+
+	vals, err := url.ParseQuery(string(query))
+	if err != nil {
+		return
+	}
+
+	if val, ok := vals["baselineProvider"]; ok {
+		options.extended = true
+		options.baselineProvider = len(val) > 0 && val[0] == "1"
+	}
+	if val := vals.Get("numbaseline"); val != "" {
+		if numbaseline, err := strconv.ParseUint(val, 10, 0); err == nil {
+			options.numbaseline = uint(numbaseline)
+		}
+	}
+	if options.numbaseline > config.Config.Baseline.Numwant.Limit {
+		options.numbaseline = config.Config.Baseline.Numwant.Limit
+	}
+
+	options.claim.Source = vals.Get("source")
+	options.claim.Timestamp, _ = strconv.ParseInt(vals.Get("timestamp"), 10, 64)
+	options.claim.Signature, _ = hex.DecodeString(vals.Get("signature"))
+	capacity, _ := strconv.ParseUint(vals.Get("capacity"), 10, 16)
+	options.claim.Capacity = uint16(capacity)
+	sent, _ := strconv.ParseUint(vals.Get("numbaseline"), 10, 32)
+	options.claim.NumBaseline = uint32(sent)
+
+	return
+}
+
+func (u *UDPTracker) announce(announce *protocol.Announce, options announceOptions, remote *net.UDPAddr, addrPort netip.AddrPort) {
 	stats.Announces.Add(1)
 
 	if announce.Port == 0 {
@@ -27,7 +84,12 @@ func (u *UDPTracker) announce(announce *protocol.Announce, remote *net.UDPAddr,
 	}
 
 	if announce.Event == protocol.EventStopped {
-		u.peerdb.Drop(announce.InfoHash, announce.PeerID, false)
+		// baseline providers are only stopped from the address they registered from
+		var provider netip.AddrPort
+		if options.baselineProvider {
+			provider = netip.AddrPortFrom(addrPort.Addr(), announce.Port)
+		}
+		u.peerdb.Drop(announce.InfoHash, announce.PeerID, provider)
 
 		resp := protocol.AnnounceResp{
 			Action:        protocol.ActionAnnounce,
@@ -36,6 +98,7 @@ func (u *UDPTracker) announce(announce *protocol.Announce, remote *net.UDPAddr,
 			Leechers:      -1,
 			Seeders:       -1,
 			Peers:         []byte{},
+			Extended:      options.extended,
 		}
 		respBytes, err := resp.Marshall()
 		if err != nil {
@@ -53,14 +116,45 @@ func (u *UDPTracker) announce(announce *protocol.Announce, remote *net.UDPAddr,
 		peerComplete = true
 	}
 
-	u.peerdb.Save(addrPort.Addr(), announce.Port, peerComplete, announce.InfoHash, announce.PeerID, announce.Uploaded, announce.Downloaded, false)
+	// refuse banned bad actors, baseline providers are never bad actors
+	var penalty storage.Penalty
+	if !options.baselineProvider {
+		penalty = u.peerdb.Penalty(addrPort.Addr())
+		if penalty.Banned(time.Now().Unix()) {
+			stats.BannedAnnounces.Add(1)
+			msg := u.newClientError("banned for bad acting", announce.TransactionID, cerrFields{"addrPort": addrPort})
+			u.sock.WriteToUDP(msg, remote)
+			return
+		}
+	}
+
+	var claim *storage.ProviderClaim
+	if options.baselineProvider {
+		claim = &options.claim
+		claim.Event = uint8(announce.Event) // storage numbers events as BEP 15 does
+	}
 
-	complete, incomplete := u.peerdb.HashStats(announce.InfoHash)
-	peers4, peers6 := u.peerdb.PeerListBytes(announce.InfoHash, uint(announce.NumWant))
+	// BEP 15 announces only carry the address they're sent from, dual-stack peers announce over each family
+	goodActing := u.peerdb.Save(addrPort.Addr(), netip.Addr{}, announce.Port, peerComplete, announce.Event == protocol.EventCompleted, announce.InfoHash, announce.PeerID, announce.Uploaded, announce.Downloaded, announce.Left, claim)
+	// Punish the "fraud" baseline provider by refusing the announce
+	if !goodActing && options.baselineProvider {
+		msg := u.newClientError("untrusted baseline provider", announce.TransactionID, cerrFields{"addrPort": addrPort, "port": announce.Port})
+		u.sock.WriteToUDP(msg, remote)
+		return
+	}
+	// the offence was just recorded so the penalty escalates
+	if !goodActing {
+		penalty = u.peerdb.Penalty(addrPort.Addr())
+	}
+
+	complete, incomplete, _ := u.peerdb.HashStats(announce.InfoHash)
+	requester := storage.Requester{ID: announce.PeerID, IP: addrPort.Addr(), Complete: peerComplete, Penalty: penalty}
+	peers4, peers6 := u.peerdb.PeerListBytes(announce.InfoHash, requester, penalty.Numwant(uint(announce.NumWant)))
 	interval := int32(config.Config.Announce.Base.Seconds())
 	if int32(config.Config.Announce.Fuzz.Seconds()) > 0 {
 		interval += rand.Int31n(int32(config.Config.Announce.Fuzz.Seconds()))
 	}
+	interval = int32(penalty.Interval(int64(interval)))
 
 	resp := protocol.AnnounceResp{
 		Action:        protocol.ActionAnnounce,
@@ -76,6 +170,28 @@ func (u *UDPTracker) announce(announce *protocol.Announce, remote *net.UDPAddr,
 		resp.Peers = peers6
 	}
 
+	// For ReliableBT aware peers that are not a complete baseline provider
+	// provide complete baseline providers if any exist, they aren't withheld as a penalty and the handout rules allow it
+	if options.extended {
+		resp.Extended = true
+		handout := options.baselineProvider || (!penalty.WithholdBaseline() && u.peerdb.HandoutBaseline(announce.InfoHash, announce.PeerID, penalty))
+		if (!options.baselineProvider || !peerComplete) && handout {
+			// the response carries each count in a single byte
+			numbaseline := options.numbaseline
+			if numbaseline > math.MaxUint8 {
+				numbaseline = math.MaxUint8
+			}
+
+			for _, provider := range u.peerdb.BaselineProviders(announce.InfoHash, announce.PeerID, numbaseline, true, true) {
+				if len(provider) == 18 {
+					resp.BaselineProviders6 = append(resp.BaselineProviders6, provider...)
+				} else {
+					resp.BaselineProviders4 = append(resp.BaselineProviders4, provider...)
+				}
+			}
+		}
+	}
+
 	respBytes, err := resp.Marshall()
 	pools.Peerlists4.Put(peers4)
 	pools.Peerlists6.Put(peers6)
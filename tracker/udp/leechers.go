@@ -0,0 +1,48 @@
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/crimist/trakx/tracker/udp/protocol"
+)
+
+// leechersMax is the most leechers that fit in a response within the max UDP payload
+const leechersMax = (0xFFFF - 8 - 20 - 16) / 18
+
+func (u *UDPTracker) leechers(request *protocol.Leechers, claim storage.ProviderClaim, remote *net.UDPAddr, addrPort netip.AddrPort) {
+	leechers, err := u.peerdb.AuthorizedLeechers(addrPort.Addr(), request.Port, request.InfoHash, request.PeerID, &claim)
+	if err != nil {
+		msg := u.newClientError(err.Error(), request.TransactionID, cerrFields{"addrPort": addrPort, "port": request.Port})
+		u.sock.WriteToUDP(msg, remote)
+		return
+	}
+	if len(leechers) > leechersMax {
+		leechers = leechers[:leechersMax]
+	}
+
+	resp := protocol.LeechersResp{
+		Action:        protocol.ActionLeechers,
+		TransactionID: request.TransactionID,
+	}
+	for _, leecher := range leechers {
+		if leecher.IP.Is6() {
+			resp.Peers6 = append(resp.Peers6, leecher.IP.AsSlice()...)
+			resp.Peers6 = binary.BigEndian.AppendUint16(resp.Peers6, leecher.Port)
+		} else {
+			resp.Peers4 = append(resp.Peers4, leecher.IP.AsSlice()...)
+			resp.Peers4 = binary.BigEndian.AppendUint16(resp.Peers4, leecher.Port)
+		}
+	}
+
+	respBytes, err := resp.Marshall()
+	if err != nil {
+		msg := u.newServerError("LeechersResp.Marshall()", err, request.TransactionID)
+		u.sock.WriteToUDP(msg, remote)
+		return
+	}
+
+	u.sock.WriteToUDP(respBytes, remote)
+}
@@ -53,6 +53,13 @@ type AnnounceResp struct {
 	Leechers      int32
 	Seeders       int32
 	Peers         []byte
+
+	// ReliableBT extension, only encoded when Extended is set.
+	// The extension is placed between the seeders and the peers as a count of IPv4 and IPv6
+	// baseline providers (uint8 each) followed by the compact baseline provider endpoints.
+	Extended           bool
+	BaselineProviders4 []byte
+	BaselineProviders6 []byte
 }
 
 // Marshall encodes an AnnounceResp to a byte slice.
@@ -74,6 +81,17 @@ func (ar *AnnounceResp) Marshall() ([]byte, error) {
 	if err := binary.Write(&buff, binary.BigEndian, ar.Seeders); err != nil {
 		return nil, errors.Wrap(err, "failed to encode announce response seeders")
 	}
+	if ar.Extended {
+		if err := binary.Write(&buff, binary.BigEndian, [2]uint8{uint8(len(ar.BaselineProviders4) / 6), uint8(len(ar.BaselineProviders6) / 18)}); err != nil {
+			return nil, errors.Wrap(err, "failed to encode announce response baseline provider counts")
+		}
+		if err := binary.Write(&buff, binary.BigEndian, ar.BaselineProviders4); err != nil {
+			return nil, errors.Wrap(err, "failed to encode announce response ipv4 baseline providers")
+		}
+		if err := binary.Write(&buff, binary.BigEndian, ar.BaselineProviders6); err != nil {
+			return nil, errors.Wrap(err, "failed to encode announce response ipv6 baseline providers")
+		}
+	}
 	if err := binary.Write(&buff, binary.BigEndian, ar.Peers); err != nil {
 		return nil, errors.Wrap(err, "failed to encode announce response peers")
 	}
@@ -82,9 +100,8 @@ func (ar *AnnounceResp) Marshall() ([]byte, error) {
 }
 
 // Unmarshall decodes a byte slice into an AnnounceResp.
+// Extended should be set beforehand if the response carries the ReliableBT extension.
 func (ar *AnnounceResp) Unmarshall(data []byte) error {
-	ar.Peers = make([]byte, (len(data) - 20))
-
 	reader := bytes.NewReader(data)
 	if err := binary.Read(reader, binary.BigEndian, &ar.Action); err != nil {
 		return errors.Wrap(err, "failed to decode announce response action")
@@ -101,6 +118,21 @@ func (ar *AnnounceResp) Unmarshall(data []byte) error {
 	if err := binary.Read(reader, binary.BigEndian, &ar.Seeders); err != nil {
 		return errors.Wrap(err, "failed to decode announce response seeders")
 	}
+	if ar.Extended {
+		var counts [2]uint8
+		if err := binary.Read(reader, binary.BigEndian, &counts); err != nil {
+			return errors.Wrap(err, "failed to decode announce response baseline provider counts")
+		}
+		ar.BaselineProviders4 = make([]byte, int(counts[0])*6)
+		ar.BaselineProviders6 = make([]byte, int(counts[1])*18)
+		if err := binary.Read(reader, binary.BigEndian, &ar.BaselineProviders4); err != nil {
+			return errors.Wrap(err, "failed to decode announce response ipv4 baseline providers")
+		}
+		if err := binary.Read(reader, binary.BigEndian, &ar.BaselineProviders6); err != nil {
+			return errors.Wrap(err, "failed to decode announce response ipv6 baseline providers")
+		}
+	}
+	ar.Peers = make([]byte, reader.Len())
 	if err := binary.Read(reader, binary.BigEndian, &ar.Peers); err != nil {
 		return errors.Wrap(err, "failed to decode announce response peers")
 	}
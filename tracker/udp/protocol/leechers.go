@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/pkg/errors"
+)
+
+// LeechersSize is the size of a leechers request without any BEP 41 options.
+const LeechersSize = 58
+
+// ReliableBT leechers request, a baseline provider asks for the leechers it is authorised to serve.
+// It is followed by BEP 41 options with the source, timestamp and signature as URL data.
+type Leechers struct {
+	ConnectionID  int64
+	Action        Action
+	TransactionID int32
+	InfoHash      storage.Hash
+	PeerID        storage.PeerID
+	Port          uint16
+}
+
+// Marshall encodes a Leechers request to a byte slice.
+func (l *Leechers) Marshall() ([]byte, error) {
+	var buff bytes.Buffer
+	buff.Grow(LeechersSize)
+	if err := binary.Write(&buff, binary.BigEndian, l); err != nil {
+		return nil, errors.Wrap(err, "failed to encode leechers")
+	}
+	return buff.Bytes(), nil
+}
+
+// Unmarshall decodes a byte slice into a Leechers request.
+func (l *Leechers) Unmarshall(data []byte) error {
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, l); err != nil {
+		return errors.Wrap(err, "failed to decode leechers")
+	}
+	return nil
+}
+
+// ReliableBT leechers response, the number of IPv4 and IPv6 leechers (uint32 each) followed by their compact endpoints.
+type LeechersResp struct {
+	Action        Action
+	TransactionID int32
+	Peers4        []byte
+	Peers6        []byte
+}
+
+// Marshall encodes a LeechersResp to a byte slice.
+func (lr *LeechersResp) Marshall() ([]byte, error) {
+	var buff bytes.Buffer
+	buff.Grow(16 + len(lr.Peers4) + len(lr.Peers6))
+
+	header := [4]uint32{uint32(lr.Action), uint32(lr.TransactionID), uint32(len(lr.Peers4) / 6), uint32(len(lr.Peers6) / 18)}
+	if err := binary.Write(&buff, binary.BigEndian, header); err != nil {
+		return nil, errors.Wrap(err, "failed to encode leechers response header")
+	}
+	buff.Write(lr.Peers4)
+	buff.Write(lr.Peers6)
+
+	return buff.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package protocol
+
+type option uint8
+
+const (
+	// AnnounceSize is the size of a BEP 15 announce without any BEP 41 options.
+	AnnounceSize = 98
+
+	OptionEndOfOptions option = 0x0
+	OptionNOP          option = 0x1
+	OptionURLData      option = 0x2
+
+	urlDataMax = 0xFF
+)
+
+// ParseURLData parses the BEP 41 options following an announce and returns the concatenated URL data.
+// Parsing stops at the first unknown option and a truncated trailing option is ignored, as other trackers do.
+// More information about the extension can be found here: https://www.bittorrent.org/beps/bep_0041.html.
+func ParseURLData(options []byte) []byte {
+	var urlData []byte
+
+	for i := 0; i < len(options); {
+		switch option(options[i]) {
+		case OptionEndOfOptions:
+			return urlData
+		case OptionNOP:
+			i++
+		case OptionURLData:
+			if i+1 >= len(options) {
+				return urlData
+			}
+			length := int(options[i+1])
+			if i+2+length > len(options) {
+				return urlData
+			}
+			urlData = append(urlData, options[i+2:i+2+length]...)
+			i += 2 + length
+		default:
+			// the length of unknown options isn't known so nothing after them can be parsed, BEP 41 has them ignored
+			return urlData
+		}
+	}
+
+	return urlData
+}
+
+// MarshallURLData encodes URL data into BEP 41 options, splitting it over as many options as required.
+func MarshallURLData(urlData []byte) []byte {
+	options := make([]byte, 0, len(urlData)+2*(len(urlData)/urlDataMax+1)+1)
+
+	for len(urlData) > 0 {
+		length := len(urlData)
+		if length > urlDataMax {
+			length = urlDataMax
+		}
+		options = append(options, byte(OptionURLData), byte(length))
+		options = append(options, urlData[:length]...)
+		urlData = urlData[length:]
+	}
+
+	return append(options, byte(OptionEndOfOptions))
+}
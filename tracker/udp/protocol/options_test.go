@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseURLData(t *testing.T) {
+	var cases = []struct {
+		name    string
+		options []byte
+		urlData []byte
+	}{
+		{"empty", nil, nil},
+		{"urlData", MarshallURLData([]byte("/announce?a=1")), []byte("/announce?a=1")},
+		{"nop", append([]byte{byte(OptionNOP)}, MarshallURLData([]byte("?a"))...), []byte("?a")},
+		{"split", []byte{byte(OptionURLData), 2, '?', 'a', byte(OptionURLData), 2, '=', '1'}, []byte("?a=1")},
+		{"unknown", []byte{byte(OptionURLData), 2, '?', 'a', 0x7F, 2, '=', '1'}, []byte("?a")},
+		// truncated trailing options are ignored
+		{"missingLength", []byte{byte(OptionURLData)}, nil},
+		{"overflow", []byte{byte(OptionURLData), 4, '?', 'a'}, nil},
+		{"truncatedAfterData", []byte{byte(OptionURLData), 2, '?', 'a', byte(OptionURLData), 4, '=', '1'}, []byte("?a")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			urlData := ParseURLData(c.options)
+			if !bytes.Equal(urlData, c.urlData) {
+				t.Errorf("ParseURLData() = %q, want %q", urlData, c.urlData)
+			}
+		})
+	}
+}
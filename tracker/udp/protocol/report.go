@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/pkg/errors"
+)
+
+// ReportSize is the size of a report without any BEP 41 options.
+const ReportSize = 97
+
+// ReliableBT misbehaviour report, the reported peer is identified by its peer ID or, if zero, its endpoint.
+// Trusted sources follow it with BEP 41 options holding baselineProvider=1 and their source, timestamp and signature as URL data.
+type Report struct {
+	ConnectionID  int64
+	Action        Action
+	TransactionID int32
+	InfoHash      storage.Hash
+	PeerID        storage.PeerID
+	Port          uint16
+	Type          storage.ReportType
+	TargetID      storage.PeerID
+	TargetIP      [16]byte // IPv4 addresses are IPv4 mapped
+	TargetPort    uint16
+}
+
+// Marshall encodes a Report to a byte slice.
+func (r *Report) Marshall() ([]byte, error) {
+	var buff bytes.Buffer
+	buff.Grow(ReportSize)
+	if err := binary.Write(&buff, binary.BigEndian, r); err != nil {
+		return nil, errors.Wrap(err, "failed to encode report")
+	}
+	return buff.Bytes(), nil
+}
+
+// Unmarshall decodes a byte slice into a Report.
+func (r *Report) Unmarshall(data []byte) error {
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, r); err != nil {
+		return errors.Wrap(err, "failed to decode report")
+	}
+	return nil
+}
+
+// Endpoint returns the endpoint of the reported peer, invalid if the report has none.
+func (r *Report) Endpoint() netip.AddrPort {
+	if r.TargetIP == ([16]byte{}) {
+		return netip.AddrPort{}
+	}
+	return netip.AddrPortFrom(netip.AddrFrom16(r.TargetIP).Unmap(), r.TargetPort)
+}
+
+// BitTorrent UDP tracker report response, an acknowledgement of the report
+type ReportResp struct {
+	Action        Action
+	TransactionID int32
+}
+
+// Marshall encodes a ReportResp to a byte slice.
+func (rr *ReportResp) Marshall() ([]byte, error) {
+	var buff bytes.Buffer
+	buff.Grow(8)
+	if err := binary.Write(&buff, binary.BigEndian, rr); err != nil {
+		return nil, errors.Wrap(err, "failed to encode report response")
+	}
+	return buff.Bytes(), nil
+}
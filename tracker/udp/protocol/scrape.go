@@ -37,11 +37,11 @@ func (s *Scrape) Unmarshall(data []byte) error {
 	return nil
 }
 
-// ScrapeInfo holds the information for each infohash in the scrape response
+// ScrapeInfo holds the information for each infohash in the scrape response, in the order BEP 15 encodes it
 type ScrapeInfo struct {
 	Complete   int32
-	Incomplete int32
 	Downloaded int32
+	Incomplete int32
 }
 
 // BitTorrent UDP tracker scrape response
@@ -53,15 +53,16 @@ type ScrapeResp struct {
 
 // Marshall encodes a ScrapeResp to a byte slice.
 func (sr *ScrapeResp) Marshall() ([]byte, error) {
-	buff := bytes.NewBuffer(make([]byte, 8+len(sr.Info)*12))
+	var buff bytes.Buffer
+	buff.Grow(8 + len(sr.Info)*12)
 
-	if err := binary.Write(buff, binary.BigEndian, sr.Action); err != nil {
+	if err := binary.Write(&buff, binary.BigEndian, sr.Action); err != nil {
 		return nil, errors.Wrap(err, "failed to encode scrape response action")
 	}
-	if err := binary.Write(buff, binary.BigEndian, sr.TransactionID); err != nil {
+	if err := binary.Write(&buff, binary.BigEndian, sr.TransactionID); err != nil {
 		return nil, errors.Wrap(err, "failed to encode scrape response transaction id")
 	}
-	if err := binary.Write(buff, binary.BigEndian, sr.Info); err != nil {
+	if err := binary.Write(&buff, binary.BigEndian, sr.Info); err != nil {
 		return nil, errors.Wrap(err, "failed to encode scrape response info")
 	}
 
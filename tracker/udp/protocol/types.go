@@ -15,6 +15,8 @@ const (
 	ActionScrape    Action = 2
 	ActionError     Action = 3
 	ActionHeartbeat Action = 4
+	ActionLeechers  Action = 5 // ReliableBT authorised leechers of a baseline provider
+	ActionReport    Action = 6 // ReliableBT misbehaviour report
 )
 
 var (
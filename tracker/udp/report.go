@@ -0,0 +1,44 @@
+package udp
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/crimist/trakx/tracker/storage"
+	"github.com/crimist/trakx/tracker/udp/protocol"
+)
+
+func (u *UDPTracker) report(request *protocol.Report, options announceOptions, remote *net.UDPAddr, addrPort netip.AddrPort) {
+	report := storage.Report{
+		Hash:     request.InfoHash,
+		Reporter: request.PeerID,
+		Port:     request.Port,
+		Type:     request.Type,
+		Target:   request.TargetID,
+		Endpoint: request.Endpoint(),
+	}
+
+	var claim *storage.ProviderClaim
+	if options.baselineProvider {
+		claim = &options.claim
+	}
+
+	if err := u.peerdb.Report(addrPort.Addr(), &report, claim); err != nil {
+		msg := u.newClientError(err.Error(), request.TransactionID, cerrFields{"addrPort": addrPort})
+		u.sock.WriteToUDP(msg, remote)
+		return
+	}
+
+	resp := protocol.ReportResp{
+		Action:        protocol.ActionReport,
+		TransactionID: request.TransactionID,
+	}
+	respBytes, err := resp.Marshall()
+	if err != nil {
+		msg := u.newServerError("ReportResp.Marshall()", err, request.TransactionID)
+		u.sock.WriteToUDP(msg, remote)
+		return
+	}
+
+	u.sock.WriteToUDP(respBytes, remote)
+}
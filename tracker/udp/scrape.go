@@ -1,6 +1,7 @@
 package udp
 
 import (
+	"math"
 	"net"
 
 	"github.com/crimist/trakx/tracker/stats"
@@ -28,11 +29,14 @@ func (u *UDPTracker) scrape(scrape *protocol.Scrape, remote *net.UDPAddr) {
 			return
 		}
 
-		complete, incomplete := u.peerdb.HashStats(hash)
+		complete, incomplete, downloaded := u.peerdb.HashStats(hash)
+		if downloaded > math.MaxInt32 {
+			downloaded = math.MaxInt32
+		}
 		info := protocol.ScrapeInfo{
 			Complete:   int32(complete),
 			Incomplete: int32(incomplete),
-			Downloaded: -1,
+			Downloaded: int32(downloaded),
 		}
 		resp.Info = append(resp.Info, info)
 	}
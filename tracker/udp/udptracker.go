@@ -141,7 +141,7 @@ func (u *UDPTracker) process(data []byte, remote *net.UDPAddr) {
 	addr = addr.Unmap() // use ipv4 instead of ipv6 mapped ipv4
 	addrPort := netip.AddrPortFrom(addr, uint16(remote.Port))
 
-	if action > protocol.ActionHeartbeat {
+	if action > protocol.ActionReport {
 		msg := u.newClientError("bad action", txid, cerrFields{"action": data[11], "addrPort": addrPort})
 		u.sock.WriteToUDP(msg, remote)
 		return
@@ -171,7 +171,7 @@ func (u *UDPTracker) process(data []byte, remote *net.UDPAddr) {
 
 	switch action {
 	case protocol.ActionAnnounce:
-		if len(data) < 98 {
+		if len(data) < protocol.AnnounceSize {
 			msg := u.newClientError("bad announce size", txid, cerrFields{"size": len(data)})
 			u.sock.WriteToUDP(msg, remote)
 			return
@@ -184,7 +184,8 @@ func (u *UDPTracker) process(data []byte, remote *net.UDPAddr) {
 			return
 		}
 
-		u.announce(&announce, remote, addrPort)
+		urlData := protocol.ParseURLData(data[protocol.AnnounceSize:])
+		u.announce(&announce, parseAnnounceOptions(urlData), remote, addrPort)
 	case protocol.ActionScrape:
 		scrape := protocol.Scrape{}
 		if err := scrape.Unmarshall(data); err != nil {
@@ -194,5 +195,37 @@ func (u *UDPTracker) process(data []byte, remote *net.UDPAddr) {
 		}
 
 		u.scrape(&scrape, remote)
+	case protocol.ActionLeechers:
+		if len(data) < protocol.LeechersSize {
+			msg := u.newClientError("bad leechers size", txid, cerrFields{"size": len(data)})
+			u.sock.WriteToUDP(msg, remote)
+			return
+		}
+
+		leechers := protocol.Leechers{}
+		if err := leechers.Unmarshall(data[:protocol.LeechersSize]); err != nil {
+			msg := u.newServerError("leechers.unmarshall()", err, txid)
+			u.sock.WriteToUDP(msg, remote)
+			return
+		}
+
+		urlData := protocol.ParseURLData(data[protocol.LeechersSize:])
+		u.leechers(&leechers, parseAnnounceOptions(urlData).claim, remote, addrPort)
+	case protocol.ActionReport:
+		if len(data) < protocol.ReportSize {
+			msg := u.newClientError("bad report size", txid, cerrFields{"size": len(data)})
+			u.sock.WriteToUDP(msg, remote)
+			return
+		}
+
+		report := protocol.Report{}
+		if err := report.Unmarshall(data[:protocol.ReportSize]); err != nil {
+			msg := u.newServerError("report.unmarshall()", err, txid)
+			u.sock.WriteToUDP(msg, remote)
+			return
+		}
+
+		urlData := protocol.ParseURLData(data[protocol.ReportSize:])
+		u.report(&report, parseAnnounceOptions(urlData), remote, addrPort)
 	}
 }
@@ -118,8 +118,17 @@ func TestUDPAnnounce(t *testing.T) {
 	if ar.Seeders != 0 {
 		t.Errorf("seeders = %v, want 1", ar.Seeders)
 	}
-	if len(ar.Peers) < 1 {
-		t.Fatal("no peers in response")
+
+	// the requester is left out of its own peer list, a second peer gets the first
+	a.TransactionID++
+	a.PeerID[0] = 0xFF
+	a.Port = 0xAABC
+	ar = udpAnnounce(t, conn, packet, a)
+	if ar.Leechers != 2 {
+		t.Errorf("leechers = %v, want 2", ar.Leechers)
+	}
+	if len(ar.Peers) != 6 {
+		t.Fatalf("peers = %v, want the first peer", ar.Peers)
 	}
 	if !bytes.Equal(ar.Peers[4:6], []byte{0xAA, 0xBB}) {
 		t.Errorf("peer port = %#v; want {0xAA, 0xBB}", ar.Peers[4:6])
@@ -184,7 +193,7 @@ func TestUDPAnnounce6(t *testing.T) {
 		ConnectionID:  cr.ConnectionID,
 		Action:        protocol.ActionAnnounce,
 		TransactionID: 7331,
-		InfoHash:      [20]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10, 0x11, 0x12, 0x13, 0x14},
+		InfoHash:      [20]byte{0x06, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10, 0x11, 0x12, 0x13, 0x14},
 		PeerID:        [20]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10, 0x11, 0x12, 0x13, 0x14},
 		Downloaded:    100,
 		Left:          100,
@@ -231,9 +240,16 @@ func TestUDPAnnounce6(t *testing.T) {
 		t.Error("Invalid seeders should be 1 but got", ar.Seeders)
 	}
 
-	if len(ar.Peers) < 1 {
-		t.Error("No peers")
-		return
+	// the requester is left out of its own peer list, a second peer gets the first
+	a.TransactionID++
+	a.PeerID[0] = 0xFF
+	a.Port = 0xAABC
+	ar = udpAnnounce(t, conn, packet, a)
+	if ar.Leechers != 2 {
+		t.Errorf("leechers = %v, want 2", ar.Leechers)
+	}
+	if len(ar.Peers) != 18 {
+		t.Fatalf("peers = %v, want the first peer", ar.Peers)
 	}
 
 	if !bytes.Equal(ar.Peers[16:18], []byte{0xAA, 0xBB}) {
@@ -342,8 +358,8 @@ func TestUDPBadConnID(t *testing.T) {
 	e := protocol.Error{}
 	e.Unmarshall(packet[:s])
 
-	if !bytes.Equal(e.ErrorString, []byte("bad connid")) {
-		t.Error("Tracker err should be 'bad connid' but got:", string(e.ErrorString))
+	if !bytes.Equal(e.ErrorString, []byte("bad connection id")) {
+		t.Error("Tracker err should be 'bad connection id' but got:", string(e.ErrorString))
 	}
 }
 
@@ -467,3 +483,202 @@ func TestUDPTransactionID(t *testing.T) {
 		}
 	}
 }
+
+func udpConnect(t *testing.T, conn *net.UDPConn, packet []byte) int64 {
+	c := protocol.Connect{
+		ProtcolID:     protocol.UDPTrackerMagic,
+		Action:        protocol.ActionConnect,
+		TransactionID: 1337,
+	}
+
+	data, err := c.Marshall()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Read(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := protocol.ConnectResp{}
+	cr.Unmarshall(packet)
+	if cr.Action != protocol.ActionConnect {
+		t.Fatalf("action = %v, want 0", cr.Action)
+	}
+
+	return cr.ConnectionID
+}
+
+func udpAnnounce(t *testing.T, conn *net.UDPConn, packet []byte, a protocol.Announce) protocol.AnnounceResp {
+	data, err := a.Marshall()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	size, err := conn.Read(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar := protocol.AnnounceResp{}
+	if action := protocol.Action(packet[3]); action == protocol.ActionError {
+		e := protocol.Error{}
+		if err := e.Unmarshall(packet[:size]); err != nil {
+			t.Fatal("failed to unmarshall tracker error:", err)
+		}
+		t.Fatal("server error:", string(e.ErrorString))
+	}
+	if err := ar.Unmarshall(packet[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	return ar
+}
+
+func udpAnnounceURLData(t *testing.T, conn *net.UDPConn, packet []byte, a protocol.Announce, urlData string) (protocol.AnnounceResp, string) {
+	data, err := a.Marshall()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, protocol.MarshallURLData([]byte(urlData))...)
+
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	size, err := conn.Read(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar := protocol.AnnounceResp{Extended: true}
+	if action := protocol.Action(packet[3]); action == protocol.ActionError {
+		e := protocol.Error{}
+		if err := e.Unmarshall(packet[:size]); err != nil {
+			t.Fatal("failed to unmarshall tracker error:", err)
+		}
+		return ar, string(e.ErrorString)
+	}
+	if err := ar.Unmarshall(packet[:size]); err != nil {
+		t.Fatal(err)
+	}
+
+	return ar, ""
+}
+
+func TestUDPAnnounceBaselineProvider(t *testing.T) {
+	packet := make([]byte, 0xFFFF)
+	addr, err := net.ResolveUDPAddr("udp4", announceUDPaddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(testTimeout))
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+
+	connid := udpConnect(t, conn, packet)
+	hash := [20]byte{0x42, 0x50, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10, 0x11, 0x12, 0x13, 0x14}
+
+	// untrusted sources are refused
+	ar, trackerErr := udpAnnounceURLData(t, conn, packet, protocol.Announce{
+		ConnectionID:  connid,
+		Action:        protocol.ActionAnnounce,
+		TransactionID: 1,
+		InfoHash:      hash,
+		PeerID:        [20]byte{0xFF},
+		Event:         protocol.EventCompleted,
+		Port:          5000,
+	}, "/announce?baselineProvider=1")
+	if trackerErr != "untrusted baseline provider" {
+		t.Errorf("tracker err = %q, want %q", trackerErr, "untrusted baseline provider")
+	}
+
+	// trusted source registers as a complete baseline provider
+	ar, trackerErr = udpAnnounceURLData(t, conn, packet, protocol.Announce{
+		ConnectionID:  connid,
+		Action:        protocol.ActionAnnounce,
+		TransactionID: 2,
+		InfoHash:      hash,
+		PeerID:        [20]byte{0xBB},
+		Event:         protocol.EventCompleted,
+		Port:          4000,
+	}, "/announce?baselineProvider=1")
+	if trackerErr != "" {
+		t.Fatal("server error:", trackerErr)
+	}
+	if ar.TransactionID != 2 {
+		t.Errorf("transactionID = %v, want 2", ar.TransactionID)
+	}
+	if len(ar.BaselineProviders4) != 0 || len(ar.BaselineProviders6) != 0 {
+		t.Errorf("complete baseline provider was given a baseline provider: %v %v", ar.BaselineProviders4, ar.BaselineProviders6)
+	}
+	if ar.Seeders != 0 || ar.Leechers != 0 {
+		t.Errorf("baseline provider counted in swarm: seeders = %v, leechers = %v", ar.Seeders, ar.Leechers)
+	}
+
+	// ReliableBT leecher receives the baseline provider
+	ar, trackerErr = udpAnnounceURLData(t, conn, packet, protocol.Announce{
+		ConnectionID:  connid,
+		Action:        protocol.ActionAnnounce,
+		TransactionID: 3,
+		InfoHash:      hash,
+		PeerID:        [20]byte{0xCC},
+		Left:          100,
+		Event:         protocol.EventStarted,
+		NumWant:       1,
+		Port:          0xAABB,
+	}, "/announce?baselineProvider=0")
+	if trackerErr != "" {
+		t.Fatal("server error:", trackerErr)
+	}
+	if ar.Leechers != 1 {
+		t.Errorf("leechers = %v, want 1", ar.Leechers)
+	}
+	if len(ar.BaselineProviders6) != 0 {
+		t.Errorf("ipv6 baseline providers = %v, want none", ar.BaselineProviders6)
+	}
+	if !bytes.Equal(ar.BaselineProviders4, []byte{127, 0, 0, 1, 0x0F, 0xA0}) {
+		t.Errorf("baseline provider = %v, want {127, 0, 0, 1, 0x0F, 0xA0}", ar.BaselineProviders4)
+	}
+	if len(ar.Peers) != 0 {
+		t.Errorf("peers = %v, want none, the requester is left out of its own list", ar.Peers)
+	}
+
+	// stopped baseline provider is no longer handed out
+	_, trackerErr = udpAnnounceURLData(t, conn, packet, protocol.Announce{
+		ConnectionID:  connid,
+		Action:        protocol.ActionAnnounce,
+		TransactionID: 4,
+		InfoHash:      hash,
+		PeerID:        [20]byte{0xBB},
+		Event:         protocol.EventStopped,
+		Port:          4000,
+	}, "/announce?baselineProvider=1")
+	if trackerErr != "" {
+		t.Fatal("server error:", trackerErr)
+	}
+	ar, trackerErr = udpAnnounceURLData(t, conn, packet, protocol.Announce{
+		ConnectionID:  connid,
+		Action:        protocol.ActionAnnounce,
+		TransactionID: 5,
+		InfoHash:      hash,
+		PeerID:        [20]byte{0xCC},
+		Left:          100,
+		NumWant:       1,
+		Port:          0xAABB,
+	}, "/announce?baselineProvider=0")
+	if trackerErr != "" {
+		t.Fatal("server error:", trackerErr)
+	}
+	if len(ar.BaselineProviders4) != 0 {
+		t.Errorf("baseline provider = %v, want none after stop", ar.BaselineProviders4)
+	}
+}
@@ -10,10 +10,23 @@ import (
 // RunOn will run the given function at the exact tick of the duration.
 // For example, RunOn(1*time.Minute, f) would execute f on the minute, every minute.
 func RunOn(duration time.Duration, run func()) {
+	RunOnUntil(duration, nil, run)
+}
+
+// RunOnUntil is RunOn until stop is closed, a nil stop runs forever.
+func RunOnUntil(duration time.Duration, stop <-chan struct{}, run func()) {
 	nextTick := time.Now().Truncate(duration)
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
 	for {
 		nextTick = nextTick.Add(duration)
-		time.Sleep(time.Until(nextTick))
+		timer.Reset(time.Until(nextTick))
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
 		run()
 	}
 }